@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"protos/gen/fileservice"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// recordSuffix is appended to a file's name for the sidecar holding its
+// server record in an exported bundle.
+const recordSuffix = ".record.json"
+
+// Export downloads filename into dir next to a sidecar holding its full
+// server record, so the pair describes itself for archival or for Import
+// into another server. The content is checked against the recorded
+// checksum.
+func (c *Client) Export(filename, dir string) error {
+	record, err := c.client.GetFileInfo(context.Background(), &fileservice.GetFileInfoRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	err = c.retry("export", func() error {
+		return c.exportContent(record, dir)
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := protojson.MarshalOptions{Multiline: true, Indent: "  ", UseProtoNames: true}.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %v", err)
+	}
+	recordPath := filepath.Join(dir, record.Filename+recordSuffix)
+	if err := os.WriteFile(recordPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write record: %v", err)
+	}
+
+	fmt.Printf("file '%v' exported to '%v' with its record in '%v'",
+		record.Filename, filepath.Join(dir, record.Filename), recordPath)
+
+	return nil
+}
+
+func (c *Client) exportContent(record *fileservice.File, dir string) error {
+	stream, err := c.client.DownloadFile(context.Background(), &fileservice.DownloadRequest{
+		Filename: record.Filename,
+		Compress: c.compress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create download stream: %w", err)
+	}
+
+	content, err := openContent(&chunkReader{stream: stream})
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	if err := c.writeDownload(io.TeeReader(content, hash), dir, record.Filename); err != nil {
+		return err
+	}
+
+	// files placed on the server by hand have no recorded checksum
+	if got := hex.EncodeToString(hash.Sum(nil)); record.Sha256 != "" && got != record.Sha256 {
+		os.Remove(filepath.Join(dir, record.Filename))
+		return fmt.Errorf("downloaded content has sha256 %v, expected %v", got, record.Sha256)
+	}
+
+	return nil
+}
+
+// Import uploads a file exported with Export, given the path of its record,
+// under its recorded name. The content must match the recorded checksum and
+// content type. Timestamps and generation are assigned by the receiving
+// server.
+func (c *Client) Import(recordPath string, overwrite bool) error {
+	if !strings.HasSuffix(recordPath, recordSuffix) {
+		return fmt.Errorf("'%v' is not a record, expected a %v file", recordPath, recordSuffix)
+	}
+
+	data, err := os.ReadFile(recordPath)
+	if err != nil {
+		return fmt.Errorf("failed to read record: %v", err)
+	}
+	record := &fileservice.File{}
+	if err := protojson.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("failed to parse record: %v", err)
+	}
+
+	contentPath := strings.TrimSuffix(recordPath, recordSuffix)
+	return c.retry("import", func() error {
+		return c.uploadFile(contentPath, &fileservice.FileInfo{
+			Filename:    record.Filename,
+			ContentType: record.ContentType,
+			Sha256:      record.Sha256,
+			Overwrite:   overwrite,
+		})
+	})
+}
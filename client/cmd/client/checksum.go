@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"protos/gen/fileservice"
+	"strings"
+)
+
+// DownloadByChecksum downloads the file whose content has the given hex
+// encoded SHA-256, under the name the server reports, and verifies the
+// content against the checksum. Any other files sharing the content are
+// listed.
+func (c *Client) DownloadByChecksum(sum string) error {
+	sum = strings.ToLower(strings.TrimSpace(sum))
+
+	found, err := c.client.FindByChecksum(context.Background(), &fileservice.FindByChecksumRequest{
+		Sha256: sum,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find file: %v", err)
+	}
+	if len(found.Files) == 0 {
+		return fmt.Errorf("no file with sha256 %v on the server", sum)
+	}
+
+	stream, err := c.client.DownloadByChecksum(context.Background(), &fileservice.DownloadByChecksumRequest{
+		Sha256:   sum,
+		Compress: c.compress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create download stream: %v", err)
+	}
+
+	chunks := &chunkReader{stream: stream}
+	content, err := openContent(chunks)
+	if err != nil {
+		return err
+	}
+
+	filename := chunks.filename
+	if !filepath.IsLocal(filename) {
+		return fmt.Errorf("server sent invalid filename %q", filename)
+	}
+
+	hash := sha256.New()
+	if err := c.writeDownload(io.TeeReader(content, hash), c.downloadDir, filename); err != nil {
+		return err
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		os.Remove(filepath.Join(c.downloadDir, filename))
+		return fmt.Errorf("downloaded content has sha256 %v, expected %v", got, sum)
+	}
+
+	fmt.Printf("file '%v' downloaded successfully", filename)
+	for _, file := range found.Files {
+		if file.Filename != filename {
+			fmt.Printf("\nsame content: '%v'", file.Filename)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// command is a non-interactive operation run from the command line, e.g.
+// "client upload report.pdf", for scripts and CI.
+type command struct {
+	usage string
+	run   func(c *Client, args []string) error
+}
+
+var commands = map[string]command{
+	"upload": {
+		usage: "upload [-overwrite] <path>",
+		run: func(c *Client, args []string) error {
+			fs := flag.NewFlagSet("upload", flag.ContinueOnError)
+			overwrite := fs.Bool("overwrite", false, "replace the file if it already exists")
+			if err := fs.Parse(args); err != nil {
+				return errUsage
+			}
+			if fs.NArg() != 1 {
+				return errUsage
+			}
+			return endLine(c.UploadFile(fs.Arg(0), *overwrite))
+		},
+	},
+	"download": {
+		usage: "download <name>",
+		run: func(c *Client, args []string) error {
+			if len(args) != 1 {
+				return errUsage
+			}
+			return endLine(c.DownloadFile(args[0]))
+		},
+	},
+	"copy": {
+		usage: "copy [-overwrite] [-if-generation-match n] <source> <destination>",
+		run: func(c *Client, args []string) error {
+			fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+			overwrite := fs.Bool("overwrite", false, "replace the destination if it already exists")
+			var generation *int64
+			fs.Func("if-generation-match", "only copy if the destination is at this generation, 0 if it must not exist", func(s string) error {
+				n, err := strconv.ParseInt(s, 10, 64)
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid generation %q", s)
+				}
+				generation = &n
+				return nil
+			})
+			if err := fs.Parse(args); err != nil {
+				return errUsage
+			}
+			if fs.NArg() != 2 {
+				return errUsage
+			}
+			return c.CopyFile(fs.Arg(0), fs.Arg(1), *overwrite, generation)
+		},
+	},
+	"list": {
+		usage: "list [pattern]",
+		run: func(c *Client, args []string) error {
+			if len(args) > 1 {
+				return errUsage
+			}
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			return c.ListFiles(pattern)
+		},
+	},
+}
+
+// commandOrder is the order commands are listed in the usage message.
+var commandOrder = []string{"upload", "download", "copy", "list"}
+
+var errUsage = errors.New("invalid arguments")
+
+// runCommand runs the command named by args[0] and returns the exit code:
+// 0 on success, 1 if the operation failed and 2 on invalid usage.
+func runCommand(c *Client, args []string) int {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		usage()
+		return 2
+	}
+
+	err := cmd.run(c, args[1:])
+	if err == errUsage {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] %s\n", os.Args[0], cmd.usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// endLine ends the line of a transfer's result message, which is printed
+// without one for the menu, if it succeeded.
+func endLine(err error) error {
+	if err == nil {
+		fmt.Println()
+	}
+	return err
+}
+
+// usage prints how to run the client, replacing flag's default message.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command the interactive menu is shown. Commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(out, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"protos/gen/fileservice"
+)
+
+// CopyFile duplicates a file on the server under a new name. Unless
+// overwrite is set, an existing file of that name is left alone. A non-nil
+// ifGenerationMatch only copies if the destination is at that generation,
+// with 0 meaning it must not exist.
+func (c *Client) CopyFile(source, destination string, overwrite bool, ifGenerationMatch *int64) error {
+	file, err := c.client.CopyFile(context.Background(), &fileservice.CopyRequest{
+		Source:            source,
+		Destination:       destination,
+		Overwrite:         overwrite,
+		IfGenerationMatch: ifGenerationMatch,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy file: %v", err)
+	}
+
+	fmt.Printf("file '%v' copied to '%v', generation %d\n", source, file.Filename, file.Generation)
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"protos/gen/fileservice"
+)
+
+// Encrypted files are a header followed by sealed records:
+//
+//	header: magic (4 bytes) | nonce prefix (8 bytes)
+//	record: ciphertext length (4 bytes, big endian) | AES-GCM ciphertext
+//
+// Each record seals one plaintext chunk with the nonce prefix and the record
+// counter as nonce. The additional data marks the final record so that a
+// truncated file fails to decrypt instead of silently losing its tail.
+var encMagic = []byte("FSE1")
+
+const (
+	encPrefixSize = 8
+	encChunkSize  = 64 * 1024
+	encSuffix     = ".enc"
+)
+
+// LoadKey reads a 256-bit key from a file holding either 32 raw bytes or
+// 64 hex characters.
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %v", err)
+	}
+
+	if key, err := hex.DecodeString(string(bytes.TrimSpace(data))); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("key file must contain 32 bytes or 64 hex characters")
+}
+
+// DownloadEncrypted downloads a file and stores it encrypted with key under
+// the download directory with an ".enc" suffix.
+func (c *Client) DownloadEncrypted(filename string, key []byte) error {
+	stream, err := c.client.DownloadFile(context.Background(), &fileservice.DownloadRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create download stream: %v", err)
+	}
+
+	fp := filepath.Join(c.downloadDir, filename+encSuffix)
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	file, err := os.Create(fp)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	enc, err := newEncryptWriter(limitWriter(file, c.rate), key)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive chunk: %v", err)
+		}
+
+		if err := verifyChunk(resp); err != nil {
+			return err
+		}
+
+		if _, err := enc.Write(resp.Chunk); err != nil {
+			return fmt.Errorf("failed to write chunk: %v", err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to finish encrypted file: %v", err)
+	}
+
+	fmt.Printf("file '%v' downloaded and encrypted to '%v'", filename, fp)
+
+	return nil
+}
+
+// OpenEncrypted opens a file written by DownloadEncrypted and returns a reader
+// yielding the decrypted content.
+func OpenEncrypted(path string, key []byte) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open encrypted file: %v", err)
+	}
+
+	dec, err := newDecryptReader(bufio.NewReader(file), key)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{dec, file}, nil
+}
+
+// DecryptFile decrypts an ".enc" file next to itself, dropping the suffix.
+func DecryptFile(path string, key []byte) error {
+	src, err := OpenEncrypted(path, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	out := path[:len(path)-len(filepath.Ext(path))]
+	if filepath.Ext(path) != encSuffix {
+		out = path + ".dec"
+	}
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(out)
+		return fmt.Errorf("failed to decrypt file: %v", err)
+	}
+
+	fmt.Printf("file '%v' decrypted to '%v'", path, out)
+
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func recordNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, encPrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixSize:], counter)
+	return nonce
+}
+
+func recordAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, key []byte) (*encryptWriter, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, encPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(append([]byte{}, encMagic...), prefix...)); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, encChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// keep a full chunk buffered so the final record is known on Close
+		if len(e.buf) == encChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the buffered data as the final record.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if e.counter == ^uint32(0) {
+		return errors.New("file too large to encrypt")
+	}
+
+	ct := e.aead.Seal(nil, recordNonce(e.prefix, e.counter), e.buf, recordAD(final))
+	e.counter++
+	e.buf = e.buf[:0]
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(ct)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(ct)
+	return err
+}
+
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r *bufio.Reader, key []byte) (*decryptReader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, len(encMagic)+encPrefixSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(encMagic)], encMagic) {
+		return nil, errors.New("not an encrypted file")
+	}
+
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		prefix: header[len(encMagic):],
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return errors.New("encrypted file is truncated")
+	}
+
+	ct := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(d.r, ct); err != nil {
+		return errors.New("encrypted file is truncated")
+	}
+
+	// a record is final exactly when nothing follows it
+	_, err := d.r.Peek(1)
+	final := err == io.EOF
+
+	plain, err := d.aead.Open(nil, recordNonce(d.prefix, d.counter), ct, recordAD(final))
+	if err != nil {
+		return errors.New("failed to decrypt: wrong key or corrupted file")
+	}
+
+	d.counter++
+	d.plain = plain
+	d.done = final
+	return nil
+}
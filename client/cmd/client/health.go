@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"protos/gen/fileservice"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// WithHealthCheck makes NewClient wait up to timeout for the server to
+// answer a health check, so an unreachable server is reported right away
+// rather than by the first operation. Zero, the default, connects lazily.
+func WithHealthCheck(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.healthTimeout = timeout
+	}
+}
+
+// checkHealth asks the server at addr for the file service's health,
+// waiting for the connection to come up until the health check times out.
+// Any answer means the server is reachable; one that is not serving, e.g.
+// in maintenance mode, is only reported.
+func (c *Client) checkHealth(addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.healthTimeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(c.conn).Check(ctx, &healthpb.HealthCheckRequest{
+		Service: fileservice.FileService_ServiceDesc.ServiceName,
+	}, grpc.WaitForReady(true))
+	if status.Code(err) == codes.Unimplemented {
+		// a server without the health service answered all the same
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("server %v is not reachable: %v", addr, err)
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		fmt.Printf("server %v reports %v\n", addr, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"protos/gen/fileservice"
+)
+
+// Inspect prints a hexdump of the start of a file on the server.
+func (c *Client) Inspect(filename string) error {
+	resp, err := c.client.GetHexdump(context.Background(), &fileservice.HexdumpRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get hexdump: %v", err)
+	}
+
+	fmt.Print(resp.Hexdump)
+	if resp.Truncated {
+		fmt.Printf("... first %d bytes of '%v' shown\n", resp.Length, filename)
+	}
+
+	return nil
+}
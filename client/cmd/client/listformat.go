@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"protos/gen/fileservice"
+	"text/template"
+)
+
+// defaultListFormat renders a file as a row of the ListFiles table.
+const defaultListFormat = `{{printf "%-30s | %12d | %-25s | %-20s | %-20s" .Filename .SizeBytes .ContentType .CreatedAt .UpdatedAt}}`
+
+// parseListFormat parses a text/template applied to each listed file and
+// checks that it executes against an empty record, so unknown fields are
+// reported before anything is listed.
+func parseListFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("list").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid list format: %v", err)
+	}
+
+	if err := tmpl.Execute(io.Discard, &fileservice.File{}); err != nil {
+		return nil, fmt.Errorf("invalid list format: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+// WithListFormat renders each file of ListFiles with tmpl instead of the
+// default table.
+func WithListFormat(tmpl *template.Template) Option {
+	return func(c *Client) {
+		c.listFormat = tmpl
+	}
+}
@@ -2,27 +2,118 @@ package main
 
 import (
 	"bufio"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // accept compressed listings
+	"google.golang.org/grpc/status"
+	"hash/crc32"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"protos/gen/fileservice"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 )
 
 const (
-	serverAddr   = "localhost:50051"
-	downloadPath = "./downloads"
+	serverAddr         = "localhost:50051"
+	defaultDownloadDir = "./downloads"
+
+	// defaultChunkSize is the size of the chunks files are uploaded in
+	// unless -chunk-size says otherwise.
+	defaultChunkSize = 32 * 1024
+	// maxChunkSize keeps chunks well below gRPC's default 4MB message limit.
+	maxChunkSize = 1024 * 1024
+	// uploadReadAhead is how many chunks are read from disk ahead of the
+	// one being sent.
+	uploadReadAhead = 4
 )
 
 func main() {
-	client, err := NewClient(serverAddr)
+	addr := flag.String("addr", serverAddr, "server address")
+	flag.StringVar(addr, "server", serverAddr, "same as -addr")
+	downloadDir := flag.String("download-dir", defaultDownloadDir, "directory downloads are written to")
+	profile := flag.String("profile", "", "apply the settings of this profile, flags given explicitly take precedence")
+	profilesFile := flag.String("profiles", cmp.Or(os.Getenv("FILESERVICE_PROFILES"), defaultProfilesFile()), "JSON file mapping profile names to flag values (env FILESERVICE_PROFILES)")
+	retries := flag.Int("retries", defaultRetryPolicy.MaxAttempts, "attempts at an upload, download or listing when the server is unavailable, 1 disables retries")
+	retryBackoff := flag.Duration("retry-backoff", defaultRetryPolicy.InitialBackoff, "wait before the first retry, doubling with each further one")
+	retryMaxBackoff := flag.Duration("retry-max-backoff", defaultRetryPolicy.MaxBackoff, "longest wait between retries")
+	chunkSize := flag.Int("chunk-size", defaultChunkSize, fmt.Sprintf("upload chunk size in bytes, at most %d", maxChunkSize))
+	rate := flag.Int64("rate", 0, "limit upload and download bandwidth in bytes per second, 0 means unlimited")
+	format := flag.String("format", "", "text/template applied to each file in the list output, e.g. '{{.Filename}}'")
+	resumable := flag.Bool("resumable", false, "keep interrupted uploads on the server and resume them on the next attempt")
+	compress := flag.Bool("compress", false, "ask the server to gzip downloads on the wire")
+	stream := flag.Bool("stream", false, "list files over a stream, printing each as it arrives instead of after the whole listing")
+	healthTimeout := flag.Duration("health-timeout", 0, "wait this long for the server to answer a health check before starting, 0 connects on first use")
+	apiKey := flag.String("api-key", os.Getenv("FILESERVICE_API_KEY"), "API key to send to servers that require one (env FILESERVICE_API_KEY)")
+	caFile := flag.String("ca", os.Getenv("FILESERVICE_CA"), "CA certificate to verify the server with over TLS, plaintext if empty (env FILESERVICE_CA)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *profile != "" {
+		if err := applyProfile(*profilesFile, *profile); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *chunkSize <= 0 || *chunkSize > maxChunkSize {
+		fmt.Printf("chunk size must be between 1 and %d, got %d\n", maxChunkSize, *chunkSize)
+		os.Exit(1)
+	}
+
+	if *retries < 1 {
+		fmt.Printf("retries must be at least 1, got %d\n", *retries)
+		os.Exit(1)
+	}
+
+	if *retryBackoff < 0 {
+		fmt.Printf("retry backoff must not be negative, got %v\n", *retryBackoff)
+		os.Exit(1)
+	}
+
+	if *retryMaxBackoff < *retryBackoff {
+		fmt.Printf("retry max backoff must be at least the retry backoff of %v, got %v\n", *retryBackoff, *retryMaxBackoff)
+		os.Exit(1)
+	}
+
+	opts := []Option{WithChunkSize(*chunkSize), WithRateLimit(*rate), WithCACert(*caFile), WithAPIKey(*apiKey), WithDownloadDir(*downloadDir), WithResumableUploads(*resumable), WithCompressedDownloads(*compress), WithStreamedList(*stream), WithHealthCheck(*healthTimeout)}
+	opts = append(opts, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    *retries,
+		InitialBackoff: *retryBackoff,
+		MaxBackoff:     *retryMaxBackoff,
+		Multiplier:     defaultRetryPolicy.Multiplier,
+	}))
+	if *format != "" {
+		tmpl, err := parseListFormat(*format)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		opts = append(opts, WithListFormat(tmpl))
+	}
+
+	client, err := NewClient(*addr, opts...)
 	if err != nil {
 		fmt.Printf("failed to create client: %s\n", err)
 		os.Exit(1)
 	}
+
+	if flag.NArg() > 0 {
+		code := runCommand(client, flag.Args())
+		client.Close()
+		os.Exit(code)
+	}
 	defer client.Close()
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -32,8 +123,21 @@ func main() {
 		fmt.Println("1. Upload file")
 		fmt.Println("2. Download file")
 		fmt.Println("3. List files")
-		fmt.Println("4. Exit")
-		fmt.Print("Enter your choice (1-4): ")
+		fmt.Println("4. List files across servers")
+		fmt.Println("5. Download file encrypted")
+		fmt.Println("6. Decrypt downloaded file")
+		fmt.Println("7. Watch directory")
+		fmt.Println("8. Inspect file")
+		fmt.Println("9. Storage stats")
+		fmt.Println("10. Resume uploads in directory")
+		fmt.Println("11. Rename file")
+		fmt.Println("12. Download file by checksum")
+		fmt.Println("13. Export file with its record")
+		fmt.Println("14. Import exported file")
+		fmt.Println("15. Download part of file")
+		fmt.Println("16. Copy file")
+		fmt.Println("17. Exit")
+		fmt.Print("Enter your choice (1-17): ")
 
 		scanner.Scan()
 		choice := scanner.Text()
@@ -44,7 +148,11 @@ func main() {
 			scanner.Scan()
 			filePath := scanner.Text()
 
-			if err := client.UploadFile(filePath); err != nil {
+			fmt.Print("Overwrite if it already exists? (y/N): ")
+			scanner.Scan()
+			overwrite := strings.EqualFold(strings.TrimSpace(scanner.Text()), "y")
+
+			if err := client.UploadFile(filePath, overwrite); err != nil {
 				fmt.Printf("upload failed: %s\n", err)
 			}
 
@@ -58,11 +166,182 @@ func main() {
 			}
 
 		case "3":
-			if err := client.ListFiles(); err != nil {
+			fmt.Print("Enter pattern to filter by, e.g. *.pdf (empty for all): ")
+			scanner.Scan()
+
+			if err := client.ListFiles(strings.TrimSpace(scanner.Text())); err != nil {
 				fmt.Printf("list files failed: %s\n", err)
 			}
 
 		case "4":
+			fmt.Print("Enter server addresses (comma-separated): ")
+			scanner.Scan()
+			var addrs []string
+			for _, addr := range strings.Split(scanner.Text(), ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+
+			if err := ListFilesAcross(addrs, *caFile, *apiKey); err != nil {
+				fmt.Printf("list files across servers failed: %s\n", err)
+			}
+
+		case "5", "6":
+			fmt.Print("Enter key file path: ")
+			scanner.Scan()
+			key, err := LoadKey(scanner.Text())
+			if err != nil {
+				fmt.Printf("failed to load key: %s\n", err)
+				continue
+			}
+
+			if choice == "5" {
+				fmt.Print("Enter filename to download: ")
+				scanner.Scan()
+				if err := client.DownloadEncrypted(scanner.Text(), key); err != nil {
+					fmt.Printf("encrypted download failed: %s\n", err)
+				}
+			} else {
+				fmt.Print("Enter encrypted file path: ")
+				scanner.Scan()
+				if err := DecryptFile(scanner.Text(), key); err != nil {
+					fmt.Printf("decrypt failed: %s\n", err)
+				}
+			}
+
+		case "7":
+			fmt.Print("Enter directory to watch: ")
+			scanner.Scan()
+			dir := scanner.Text()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			if err := client.Watch(ctx, dir); err != nil {
+				fmt.Printf("watch failed: %s\n", err)
+			}
+			stop()
+
+		case "8":
+			fmt.Print("Enter filename to inspect: ")
+			scanner.Scan()
+			if err := client.Inspect(scanner.Text()); err != nil {
+				fmt.Printf("inspect failed: %s\n", err)
+			}
+
+		case "9":
+			fmt.Print("Refresh every N seconds, Ctrl+C to stop (empty for a one-off summary): ")
+			scanner.Scan()
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				if err := client.Stats(); err != nil {
+					fmt.Printf("stats failed: %s\n", err)
+				}
+				break
+			}
+
+			seconds, err := strconv.Atoi(text)
+			if err != nil || seconds <= 0 {
+				fmt.Println("Invalid interval.")
+				break
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			if err := client.WatchStats(ctx, time.Duration(seconds)*time.Second); err != nil {
+				fmt.Printf("stats failed: %s\n", err)
+			}
+			stop()
+
+		case "10":
+			fmt.Print("Enter directory to resume: ")
+			scanner.Scan()
+			if err := client.ResumeDir(scanner.Text()); err != nil {
+				fmt.Printf("resume failed: %s\n", err)
+			}
+
+		case "11":
+			fmt.Print("Enter filename to rename: ")
+			scanner.Scan()
+			from := scanner.Text()
+
+			fmt.Print("Enter new filename: ")
+			scanner.Scan()
+			if err := client.RenameFile(from, scanner.Text()); err != nil {
+				fmt.Printf("rename failed: %s\n", err)
+			}
+
+		case "12":
+			fmt.Print("Enter sha256 of the content: ")
+			scanner.Scan()
+			if err := client.DownloadByChecksum(scanner.Text()); err != nil {
+				fmt.Printf("download failed: %s\n", err)
+			}
+
+		case "13":
+			fmt.Print("Enter filename to export: ")
+			scanner.Scan()
+			filename := scanner.Text()
+
+			fmt.Print("Enter directory to export to: ")
+			scanner.Scan()
+			if err := client.Export(filename, scanner.Text()); err != nil {
+				fmt.Printf("export failed: %s\n", err)
+			}
+
+		case "14":
+			fmt.Print("Enter path of the " + recordSuffix + " record to import: ")
+			scanner.Scan()
+			recordPath := scanner.Text()
+
+			fmt.Print("Overwrite if it already exists? (y/N): ")
+			scanner.Scan()
+			overwrite := strings.EqualFold(strings.TrimSpace(scanner.Text()), "y")
+
+			if err := client.Import(recordPath, overwrite); err != nil {
+				fmt.Printf("import failed: %s\n", err)
+			}
+
+		case "15":
+			fmt.Print("Enter filename to download: ")
+			scanner.Scan()
+			filename := scanner.Text()
+
+			fmt.Print("Enter offset (empty to continue the local copy): ")
+			scanner.Scan()
+			offset, err := parseRangeField(scanner.Text(), -1)
+			if err != nil {
+				fmt.Println("Invalid offset.")
+				break
+			}
+
+			fmt.Print("Enter length in bytes (empty for the rest of the file): ")
+			scanner.Scan()
+			length, err := parseRangeField(scanner.Text(), 0)
+			if err != nil {
+				fmt.Println("Invalid length.")
+				break
+			}
+
+			if err := client.DownloadRange(filename, offset, length); err != nil {
+				fmt.Printf("download failed: %s\n", err)
+			}
+
+		case "16":
+			fmt.Print("Enter filename to copy: ")
+			scanner.Scan()
+			source := scanner.Text()
+
+			fmt.Print("Enter filename of the copy: ")
+			scanner.Scan()
+			destination := scanner.Text()
+
+			fmt.Print("Overwrite if it already exists? (y/N): ")
+			scanner.Scan()
+			overwrite := strings.EqualFold(strings.TrimSpace(scanner.Text()), "y")
+
+			if err := client.CopyFile(source, destination, overwrite, nil); err != nil {
+				fmt.Printf("copy failed: %s\n", err)
+			}
+
+		case "17":
 			fmt.Println("Exiting...")
 			return
 
@@ -73,23 +352,102 @@ func main() {
 }
 
 type Client struct {
-	conn   *grpc.ClientConn
-	client fileservice.FileServiceClient
+	conn       *grpc.ClientConn
+	client     fileservice.FileServiceClient
+	rate       int64
+	listFormat *template.Template
+	caFile     string
+	apiKey     string
+	// downloadDir is where downloads are written
+	downloadDir string
+	resumable   bool
+	compress    bool
+	streamList  bool
+	chunkSize   int
+	// retryPolicy applies to uploads, downloads and listings
+	retryPolicy RetryPolicy
+	// healthTimeout bounds the health check in NewClient, 0 skips it
+	healthTimeout time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithDownloadDir sets the directory downloads are written to, ./downloads
+// by default.
+func WithDownloadDir(dir string) Option {
+	return func(c *Client) {
+		c.downloadDir = dir
+	}
+}
+
+// WithChunkSize sets the size of the chunks uploads are sent in.
+func WithChunkSize(size int) Option {
+	return func(c *Client) {
+		c.chunkSize = size
+	}
+}
+
+// WithRateLimit caps upload and download bandwidth in bytes per second.
+// Zero means unlimited.
+func WithRateLimit(rate int64) Option {
+	return func(c *Client) {
+		c.rate = rate
+	}
+}
+
+// WithResumableUploads makes interrupted uploads resume where they stopped
+// instead of starting over.
+func WithResumableUploads(resumable bool) Option {
+	return func(c *Client) {
+		c.resumable = resumable
+	}
+}
+
+// WithCompressedDownloads has downloads sent gzip compressed, which saves
+// bandwidth on text-heavy files. They are decompressed before being written.
+func WithCompressedDownloads(compress bool) Option {
+	return func(c *Client) {
+		c.compress = compress
+	}
+}
+
+// WithStreamedList has ListFiles consume the server's file stream and print
+// each file as it arrives, which starts output sooner on huge directories.
+func WithStreamedList(stream bool) Option {
+	return func(c *Client) {
+		c.streamList = stream
+	}
 }
 
-func NewClient(serverAddr string) (*Client, error) {
-	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(serverAddr string, opts ...Option) (*Client, error) {
+	c := &Client{chunkSize: defaultChunkSize, retryPolicy: defaultRetryPolicy, downloadDir: defaultDownloadDir}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	dialOpts, err := dialOptions(c.caFile, c.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(serverAddr, dialOpts...)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server: %v\n", err)
 	}
 
-	client := fileservice.NewFileServiceClient(conn)
+	c.conn = conn
+	c.client = fileservice.NewFileServiceClient(conn)
 
-	return &Client{
-		conn:   conn,
-		client: client,
-	}, nil
+	if c.healthTimeout > 0 {
+		if err := c.checkHealth(serverAddr); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
 func (c *Client) Close() {
@@ -98,66 +456,183 @@ func (c *Client) Close() {
 	}
 }
 
-func (c *Client) UploadFile(filePath string) error {
+// UploadFile uploads the file at filePath, retrying from the start if the
+// server is unavailable. Unless overwrite is set, a file of the same name
+// already on the server is left alone and the upload fails.
+func (c *Client) UploadFile(filePath string, overwrite bool) error {
+	return c.retry("upload", func() error {
+		return c.uploadFile(filePath, &fileservice.FileInfo{
+			Filename:  filepath.Base(filePath),
+			Overwrite: overwrite,
+		})
+	})
+}
+
+// uploadFile uploads the file at filePath as described by info, filling in
+// its checksum and size. A checksum already set in info must match the file.
+func (c *Client) uploadFile(filePath string, info *fileservice.FileInfo) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %v", err)
 	}
 	defer file.Close()
 
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return fmt.Errorf("failed to hash file: %v", err)
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to get file size: %v", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if info.Sha256 != "" && !strings.EqualFold(info.Sha256, sum) {
+		return fmt.Errorf("file '%v' has sha256 %v, expected %v", filePath, sum, info.Sha256)
+	}
+	info.Sha256 = sum
+	info.Size = size
+
+	filename := info.Filename
+
+	if c.resumable {
+		resp, err := c.client.GetUploadOffset(context.Background(), &fileservice.UploadOffsetRequest{
+			Filename: filename,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get upload offset: %w", err)
+		}
+		if resp.Offset > size {
+			return fmt.Errorf("server holds %d bytes of '%v' but the file has only %d", resp.Offset, filename, size)
+		}
+		if resp.Offset > 0 {
+			fmt.Printf("resuming upload of '%v' at byte %d\n", filename, resp.Offset)
+		}
+
+		info.Resumable = true
+		info.Offset = resp.Offset
+	}
+
+	if _, err := file.Seek(info.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %v", err)
+	}
+
 	stream, err := c.client.UploadFile(context.Background())
 	if err != nil {
-		return fmt.Errorf("failed to create upload stream: %v", err)
+		return fmt.Errorf("failed to create upload stream: %w", err)
 	}
 
 	// Send file info first
-	filename := filepath.Base(filePath)
 	if err := stream.Send(&fileservice.UploadRequest{
 		Data: &fileservice.UploadRequest_Info{
-			Info: &fileservice.FileInfo{Filename: filename},
+			Info: info,
 		},
 	}); err != nil {
-		return fmt.Errorf("failed to send file info: %v", err)
+		return fmt.Errorf("failed to send file info: %w", err)
 	}
 
-	buf := make([]byte, 1024*32) // 32KB chunks
-	for {
-		n, err := file.Read(buf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to read file chunk: %v", err)
-		}
+	done := make(chan struct{})
+	defer close(done)
+	chunks, readErr := readChunks(limitReader(file, c.rate), c.chunkSize, done)
+
+	sent := newProgress(fmt.Sprintf("uploading '%v'", filename), info.Offset, size)
 
+	for chunk := range chunks {
+		crc := crc32.ChecksumIEEE(chunk)
 		if err := stream.Send(&fileservice.UploadRequest{
 			Data: &fileservice.UploadRequest_Chunk{
-				Chunk: buf[:n],
+				Chunk: chunk,
 			},
-		}); err != nil {
-			return fmt.Errorf("failed to send file chunk: %v", err)
+			ChunkCrc32: &crc,
+		}); err == io.EOF {
+			// the server ended the upload early, its status says why
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to send file chunk: %w", err)
 		}
+		sent.add(len(chunk))
+	}
+	sent.finish()
+	select {
+	case err := <-readErr:
+		if err != nil {
+			return fmt.Errorf("failed to read file chunk: %v", err)
+		}
+	default: // stopped early, the reader is still running
 	}
 
 	resp, err := stream.CloseAndRecv()
+	if status.Code(err) == codes.AlreadyExists {
+		return fmt.Errorf("file '%v' already exists on the server, upload it with overwrite to replace it", filename)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to receive response: %v", err)
+		return fmt.Errorf("failed to receive response: %w", err)
 	}
 
-	fmt.Printf("file '%v' uploaded successfully", resp.Filename)
+	if resp.Result == fileservice.UploadResult_UPLOAD_RESULT_UNCHANGED {
+		fmt.Printf("file '%v' is already up to date, sha256 %v", resp.Filename, resp.Sha256)
+		return nil
+	}
+
+	fmt.Printf("file '%v' uploaded successfully, sha256 %v", resp.Filename, resp.Sha256)
 
 	return nil
 }
 
+// DownloadFile downloads filename into the download directory, starting
+// over if the server becomes unavailable.
 func (c *Client) DownloadFile(filename string) error {
+	return c.retry("download", func() error {
+		return c.downloadFile(filename)
+	})
+}
+
+func (c *Client) downloadFile(filename string) error {
 	stream, err := c.client.DownloadFile(context.Background(), &fileservice.DownloadRequest{
 		Filename: filename,
+		Compress: c.compress,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create download stream: %v", err)
+		return fmt.Errorf("failed to create download stream: %w", err)
+	}
+
+	content, err := openContent(&chunkReader{stream: stream})
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeDownload(content, c.downloadDir, filename); err != nil {
+		return err
+	}
+
+	fmt.Printf("file '%v' downloaded successfully", filename)
+
+	return nil
+}
+
+// openContent returns the content received by chunks, decompressed if the
+// server compressed it. The first chunk has been received when it returns.
+func openContent(chunks *chunkReader) (io.Reader, error) {
+	src := bufio.NewReader(chunks)
+
+	// the first chunk says whether the server compressed the content, an
+	// older server ignores the request
+	if _, err := src.Peek(1); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if !chunks.compressed {
+		return src, nil
+	}
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress file: %v", err)
 	}
+	return zr, nil
+}
 
-	fp := filepath.Join(downloadPath, filename)
+// writeDownload copies content to filename under dir.
+func (c *Client) writeDownload(content io.Reader, dir, filename string) error {
+	fp := filepath.Join(dir, filename)
 
 	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %v", err)
@@ -169,39 +644,210 @@ func (c *Client) DownloadFile(filename string) error {
 	}
 	defer file.Close()
 
-	for {
-		resp, err := stream.Recv()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("failed to receive chunk: %v", err)
-		}
+	written := newProgress(fmt.Sprintf("downloading '%v'", filename), 0, -1)
+	_, err = io.Copy(io.MultiWriter(limitWriter(file, c.rate), written), content)
+	written.finish()
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
 
-		if _, err := file.Write(resp.Chunk); err != nil {
-			return fmt.Errorf("failed to write chunk: %v", err)
+	return nil
+}
+
+// ListFiles prints the files on the server whose name matches pattern, or
+// all of them if it is empty.
+func (c *Client) ListFiles(pattern string) error {
+	if c.streamList {
+		return c.streamFiles(pattern)
+	}
+
+	var listed *fileservice.ListResponse
+	err := c.retry("list", func() (err error) {
+		listed, err = listAll(context.Background(), c.client, pattern)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list files: %v", err)
+	}
+
+	tmpl := c.listFormat
+	if tmpl == nil {
+		tmpl = template.Must(template.New("list").Parse(defaultListFormat))
+
+		fmt.Println("Files on server:")
+		fmt.Printf("%-30s | %12s | %-25s | %-20s | %-20s\n", "Filename", "Size", "Content Type", "Created At", "Updated At")
+	}
+
+	for _, file := range listed.Files {
+		if err := tmpl.Execute(os.Stdout, file); err != nil {
+			return fmt.Errorf("failed to render file: %v", err)
 		}
+		fmt.Println()
 	}
 
-	fmt.Printf("file '%v' downloaded successfully", filename)
+	if c.listFormat == nil {
+		fmt.Printf("%d files, %d bytes\n", listed.TotalFiles, listed.TotalBytes)
+	}
 
 	return nil
 }
 
-func (c *Client) ListFiles() error {
-	resp, err := c.client.ListFiles(context.Background(), &fileservice.ListRequest{})
+// streamFiles is ListFiles over ListFilesStream: rows are printed as the
+// files arrive, and the totals are summed up on the way.
+func (c *Client) streamFiles(pattern string) error {
+	tmpl := c.listFormat
+	if tmpl == nil {
+		tmpl = template.Must(template.New("list").Parse(defaultListFormat))
+
+		fmt.Println("Files on server:")
+		fmt.Printf("%-30s | %12s | %-25s | %-20s | %-20s\n", "Filename", "Size", "Content Type", "Created At", "Updated At")
+	}
+
+	var (
+		count, size int64
+		last        string
+	)
+	// a retry picks up after the last file printed
+	err := c.retry("list", func() error {
+		stream, err := c.client.ListFilesStream(context.Background(), &fileservice.ListStreamRequest{
+			StartAfter: last,
+			Pattern:    pattern,
+		})
+		if err != nil {
+			return err
+		}
+
+		for {
+			file, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := tmpl.Execute(os.Stdout, file); err != nil {
+				return fmt.Errorf("failed to render file: %v", err)
+			}
+			fmt.Println()
+
+			count++
+			size += file.SizeBytes
+			last = file.Filename
+		}
+	})
 	if err != nil {
 		return fmt.Errorf("failed to list files: %v", err)
 	}
 
-	fmt.Println("Files on server:")
-	fmt.Printf("%-30s | %-20s | %-20s\n", "Filename", "Created At", "Updated At")
-	for _, file := range resp.Files {
-		fmt.Printf("%-30s | %-20s | %-20s\n",
-			file.Filename,
-			file.CreatedAt,
-			file.UpdatedAt)
+	if c.listFormat == nil {
+		fmt.Printf("%d files, %d bytes\n", count, size)
 	}
 
 	return nil
 }
+
+// listAll fetches every page of the server's file listing, filtered by
+// pattern unless it is empty.
+func listAll(ctx context.Context, client fileservice.FileServiceClient, pattern string) (*fileservice.ListResponse, error) {
+	var (
+		listed = &fileservice.ListResponse{}
+		token  string
+	)
+	for {
+		resp, err := client.ListFiles(ctx, &fileservice.ListRequest{
+			PageToken: token,
+			Pattern:   pattern,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		listed.Files = append(listed.Files, resp.Files...)
+		listed.TotalFiles = resp.TotalFiles
+		listed.TotalBytes = resp.TotalBytes
+		if resp.NextPageToken == "" {
+			return listed, nil
+		}
+		token = resp.NextPageToken
+	}
+}
+
+// readChunks reads r in chunks of size bytes on its own goroutine, up to
+// uploadReadAhead chunks ahead of the caller, so disk reads overlap with
+// network sends. The chunk channel is closed at the end of r, after which
+// errc holds the read error, or nil. Closing done stops the reader early.
+func readChunks(r io.Reader, size int, done <-chan struct{}) (<-chan []byte, <-chan error) {
+	chunks := make(chan []byte, uploadReadAhead)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(chunks)
+		for {
+			// a fresh buffer per chunk, earlier ones may still be queued
+			buf := make([]byte, size)
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case chunks <- buf[:n]:
+				case <-done:
+					return
+				}
+			}
+			if err == io.EOF {
+				errc <- nil
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	return chunks, errc
+}
+
+// verifyChunk checks a downloaded chunk against its checksum, if the server
+// sent one.
+func verifyChunk(resp *fileservice.DownloadResponse) error {
+	if resp.ChunkCrc32 != nil && crc32.ChecksumIEEE(resp.Chunk) != *resp.ChunkCrc32 {
+		return fmt.Errorf("chunk checksum mismatch, download corrupted")
+	}
+	return nil
+}
+
+// chunkReader reads the content of a download stream, verifying each chunk.
+type chunkReader struct {
+	stream     fileservice.FileService_DownloadFileClient
+	rest       []byte
+	compressed bool
+	// filename is the name the server announced, if any
+	filename string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.rest) == 0 {
+		resp, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to receive chunk: %w", err)
+		}
+
+		if err := verifyChunk(resp); err != nil {
+			return 0, err
+		}
+
+		r.rest = resp.Chunk
+		r.compressed = resp.Compressed
+		if resp.Filename != "" {
+			r.filename = resp.Filename
+		}
+	}
+
+	n := copy(p, r.rest)
+	r.rest = r.rest[n:]
+	return n, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"protos/gen/fileservice"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// discardServer accepts uploads and throws their content away.
+type discardServer struct {
+	fileservice.UnimplementedFileServiceServer
+}
+
+func (discardServer) UploadFile(stream fileservice.FileService_UploadFileServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	filename := req.GetInfo().GetFilename()
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(&fileservice.UploadResponse{Filename: filename})
+}
+
+// newBenchClient returns a client of a discardServer listening in memory.
+func newBenchClient(b *testing.B) *Client {
+	b.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	fileservice.RegisterFileServiceServer(srv, discardServer{})
+	go srv.Serve(lis)
+	b.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+
+	return &Client{
+		conn:        conn,
+		client:      fileservice.NewFileServiceClient(conn),
+		chunkSize:   defaultChunkSize,
+		retryPolicy: defaultRetryPolicy,
+	}
+}
+
+// silenceStdout discards what the client prints until the benchmark ends.
+func silenceStdout(b *testing.B) {
+	b.Helper()
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = devNull
+	b.Cleanup(func() {
+		os.Stdout = stdout
+		devNull.Close()
+	})
+}
+
+func BenchmarkUploadFile(b *testing.B) {
+	c := newBenchClient(b)
+
+	content := make([]byte, 8<<20)
+	rand.Read(content)
+	fp := filepath.Join(b.TempDir(), "bench.bin")
+	if err := os.WriteFile(fp, content, 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	silenceStdout(b)
+	b.SetBytes(int64(len(content)))
+	for b.Loop() {
+		if err := c.UploadFile(fp, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// slowReader is a disk taking latency to serve every read.
+type slowReader struct {
+	r       io.Reader
+	latency time.Duration
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.latency)
+	return r.r.Read(p)
+}
+
+// BenchmarkReadChunks compares sending chunks as they are read with reading
+// them ahead, when reads and sends each take some latency.
+func BenchmarkReadChunks(b *testing.B) {
+	const latency = 100 * time.Microsecond
+	content := make([]byte, 4<<20)
+	send := func([]byte) { time.Sleep(latency) }
+
+	b.Run("synchronous", func(b *testing.B) {
+		b.SetBytes(int64(len(content)))
+		for b.Loop() {
+			r := slowReader{bytes.NewReader(content), latency}
+			buf := make([]byte, defaultChunkSize)
+			for {
+				n, err := r.Read(buf)
+				if n > 0 {
+					send(buf[:n])
+				}
+				if err != nil {
+					break
+				}
+			}
+		}
+	})
+
+	b.Run("read-ahead", func(b *testing.B) {
+		b.SetBytes(int64(len(content)))
+		for b.Loop() {
+			done := make(chan struct{})
+			chunks, errc := readChunks(slowReader{bytes.NewReader(content), latency}, defaultChunkSize, done)
+			for chunk := range chunks {
+				send(chunk)
+			}
+			if err := <-errc; err != nil {
+				b.Fatal(err)
+			}
+			close(done)
+		}
+	})
+}
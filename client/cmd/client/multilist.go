@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/grpc"
+	"protos/gen/fileservice"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// mergedFile is a file seen on one or more servers.
+type mergedFile struct {
+	Filename string
+	Servers  []string
+}
+
+// ListFilesAcross queries ListFiles on every server concurrently and prints
+// the merged listing, deduplicated by filename. apiKey, if set, is sent to
+// every server.
+func ListFilesAcross(addrs []string, caFile, apiKey string) error {
+	if len(addrs) == 0 {
+		return fmt.Errorf("no server addresses given")
+	}
+
+	dialOpts, err := dialOptions(caFile, apiKey)
+	if err != nil {
+		return err
+	}
+
+	clients := make(map[string]fileservice.FileServiceClient, len(addrs))
+	for _, addr := range addrs {
+		conn, err := grpc.NewClient(addr, dialOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to connect to server %s: %v", addr, err)
+		}
+		defer conn.Close()
+
+		clients[addr] = fileservice.NewFileServiceClient(conn)
+	}
+
+	files, errs := mergeListings(context.Background(), clients)
+	for addr, err := range errs {
+		fmt.Printf("failed to list files on %s: %s\n", addr, err)
+	}
+	if len(errs) == len(clients) {
+		return fmt.Errorf("no server responded")
+	}
+
+	fmt.Println("Files across servers:")
+	fmt.Printf("%-30s | %s\n", "Filename", "Servers")
+	for _, file := range files {
+		fmt.Printf("%-30s | %s\n", file.Filename, strings.Join(file.Servers, ", "))
+	}
+
+	return nil
+}
+
+// mergeListings lists files on all clients in parallel and merges the results
+// by filename. Servers that fail are reported in the returned error map and
+// left out of the merge.
+func mergeListings(
+	ctx context.Context,
+	clients map[string]fileservice.FileServiceClient,
+) ([]mergedFile, map[string]error) {
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		owners = make(map[string][]string)
+		errs   = make(map[string]error)
+	)
+
+	for addr, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			listed, err := listAll(ctx, client, "")
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[addr] = err
+				return
+			}
+			for _, file := range listed.Files {
+				owners[file.Filename] = append(owners[file.Filename], addr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	files := make([]mergedFile, 0, len(owners))
+	for filename, servers := range owners {
+		sort.Strings(servers)
+		files = append(files, mergedFile{Filename: filename, Servers: servers})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filename < files[j].Filename
+	})
+
+	return files, errs
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultProfilesFile returns where profiles are read from unless -profiles
+// or FILESERVICE_PROFILES says otherwise.
+func defaultProfilesFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fileservice", "profiles.json")
+}
+
+// applyProfile sets the flags stored in the named profile of the profiles
+// file, except those given on the command line. The file maps profile names
+// to flag values, e.g.
+//
+//	{"prod": {"addr": "files.example.com:443", "ca": "/etc/ssl/prod-ca.pem"}}
+func applyProfile(path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read profiles: %v", err)
+	}
+
+	var profiles map[string]map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // keep numbers as written for flag.Set
+	if err := dec.Decode(&profiles); err != nil {
+		return fmt.Errorf("failed to parse profiles: %v", err)
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("unknown profile %q, %s has: %s", name, path, strings.Join(names, ", "))
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, value := range profile {
+		if key == "profile" || key == "profiles" || flag.Lookup(key) == nil {
+			return fmt.Errorf("invalid setting %q in profile %q", key, name)
+		}
+		if explicit[key] {
+			continue
+		}
+		if err := flag.Set(key, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("invalid setting %q in profile %q: %v", key, name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// progressInterval is how often the progress line of a transfer is redrawn.
+// Transfers finishing sooner print no progress at all.
+const progressInterval = 500 * time.Millisecond
+
+// progress draws a live progress line for a transfer, overwriting itself in
+// place.
+type progress struct {
+	label   string
+	total   int64 // -1 if unknown
+	done    int64
+	last    time.Time
+	printed bool
+}
+
+func newProgress(label string, done, total int64) *progress {
+	return &progress{label: label, done: done, total: total, last: time.Now()}
+}
+
+// add accounts for n more transferred bytes.
+func (p *progress) add(n int) {
+	p.done += int64(n)
+	if time.Since(p.last) >= progressInterval {
+		p.print()
+	}
+}
+
+// Write counts the bytes written, so a progress can sit in an io.MultiWriter.
+func (p *progress) Write(b []byte) (int, error) {
+	p.add(len(b))
+	return len(b), nil
+}
+
+// finish draws the final state and ends the line, if anything was drawn.
+func (p *progress) finish() {
+	if p.printed {
+		p.print()
+		fmt.Println()
+	}
+}
+
+func (p *progress) print() {
+	if p.total > 0 {
+		fmt.Printf("\r%s: %d / %d bytes (%d%%)", p.label, p.done, p.total, p.done*100/p.total)
+	} else {
+		fmt.Printf("\r%s: %d bytes", p.label, p.done)
+	}
+	p.last = time.Now()
+	p.printed = true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimiter paces a transfer to an average number of bytes per second.
+type rateLimiter struct {
+	rate  int64
+	start time.Time
+	total int64
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{rate: rate, start: time.Now()}
+}
+
+// wait accounts for n transferred bytes and sleeps until the average rate
+// drops back to the limit.
+func (l *rateLimiter) wait(n int) {
+	l.total += int64(n)
+	due := time.Duration(float64(l.total) / float64(l.rate) * float64(time.Second))
+	if d := due - time.Since(l.start); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+type rateLimitedReader struct {
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.limiter.wait(n)
+	return n, err
+}
+
+type rateLimitedWriter struct {
+	w       io.Writer
+	limiter *rateLimiter
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.limiter.wait(n)
+	return n, err
+}
+
+// limitReader throttles r to rate bytes per second. A zero rate means unlimited.
+func limitReader(r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
+	}
+	return &rateLimitedReader{r: r, limiter: newRateLimiter(rate)}
+}
+
+// limitWriter throttles w to rate bytes per second. A zero rate means unlimited.
+func limitWriter(w io.Writer, rate int64) io.Writer {
+	if rate <= 0 {
+		return w
+	}
+	return &rateLimitedWriter{w: w, limiter: newRateLimiter(rate)}
+}
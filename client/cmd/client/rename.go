@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"protos/gen/fileservice"
+)
+
+// RenameFile moves a file on the server to a new name.
+func (c *Client) RenameFile(from, to string) error {
+	file, err := c.client.RenameFile(context.Background(), &fileservice.RenameRequest{
+		From: from,
+		To:   to,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename file: %v", err)
+	}
+
+	fmt.Printf("file '%v' renamed to '%v'\n", from, file.Filename)
+	return nil
+}
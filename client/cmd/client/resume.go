@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"protos/gen/fileservice"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ResumeDir recovers an interrupted batch upload of the files in dir. Files
+// the server holds part of are resumed, files it does not have are uploaded
+// and files it already has with the same checksum are skipped. A file the
+// server has with other content is left alone and reported.
+func (c *Client) ResumeDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	// every upload in the batch keeps its bytes if interrupted again
+	rc := *c
+	rc.resumable = true
+
+	var uploaded, resumed, upToDate, conflicts, failed int
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") || !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		state, err := c.remoteState(path)
+		if err != nil {
+			fmt.Printf("'%v': %s\n", entry.Name(), err)
+			failed++
+			continue
+		}
+
+		switch state {
+		case remoteUpToDate:
+			upToDate++
+			continue
+		case remoteConflict:
+			fmt.Printf("'%v' exists on the server with other content, skipping\n", entry.Name())
+			conflicts++
+			continue
+		}
+
+		if err := rc.UploadFile(path, false); err != nil {
+			fmt.Printf("upload failed: %s\n", err)
+			failed++
+			continue
+		}
+		fmt.Println()
+
+		if state == remotePartial {
+			resumed++
+		} else {
+			uploaded++
+		}
+	}
+
+	fmt.Printf("%d uploaded, %d resumed, %d up to date, %d conflicting, %d failed\n",
+		uploaded, resumed, upToDate, conflicts, failed)
+	return nil
+}
+
+// remoteState is what the server holds of a local file.
+type remoteState int
+
+const (
+	remoteMissing remoteState = iota
+	remotePartial
+	remoteUpToDate
+	remoteConflict
+)
+
+// remoteState compares the local file at path with the server's copy.
+func (c *Client) remoteState(path string) (remoteState, error) {
+	filename := filepath.Base(path)
+
+	file, err := c.client.GetFileInfo(context.Background(), &fileservice.GetFileInfoRequest{
+		Filename: filename,
+	})
+	switch status.Code(err) {
+	case codes.OK:
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return 0, err
+		}
+		if strings.EqualFold(file.Sha256, hex.EncodeToString(sum[:])) {
+			return remoteUpToDate, nil
+		}
+		return remoteConflict, nil
+	case codes.NotFound:
+	default:
+		return 0, fmt.Errorf("failed to get file info: %v", err)
+	}
+
+	resp, err := c.client.GetUploadOffset(context.Background(), &fileservice.UploadOffsetRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get upload offset: %v", err)
+	}
+	if resp.Offset > 0 {
+		return remotePartial, nil
+	}
+	return remoteMissing, nil
+}
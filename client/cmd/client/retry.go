@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy controls how uploads, downloads and listings are retried when
+// the server is briefly unavailable.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries including the first, 1 disables
+	// retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. Each further retry
+	// waits Multiplier times longer, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+// defaultRetryPolicy is used unless WithRetryPolicy says otherwise.
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+}
+
+// WithRetryPolicy sets how operations are retried on transient errors.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// retriable reports whether err is worth retrying: the server was
+// unreachable or did not answer in time. Anything else, e.g. an invalid
+// argument, fails right away.
+func retriable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// retry runs fn until it succeeds, fails with an error that is not
+// retriable or runs out of attempts, backing off exponentially in between.
+// fn must start over cleanly each time it is called.
+func (c *Client) retry(op string, fn func() error) error {
+	policy := c.retryPolicy
+	backoff := policy.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !retriable(err) || attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		// wait between half and all of the backoff, so clients cut off
+		// together do not come back together
+		wait := backoff/2 + rand.N(backoff/2+1)
+		fmt.Printf("\n%s failed (%v), retrying in %v (attempt %d of %d)\n",
+			op, status.Code(err), wait.Round(time.Millisecond), attempt+1, policy.MaxAttempts)
+		time.Sleep(wait)
+
+		backoff = min(time.Duration(float64(backoff)*policy.Multiplier), policy.MaxBackoff)
+	}
+}
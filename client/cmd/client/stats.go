@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"protos/gen/fileservice"
+	"time"
+)
+
+// Stats prints a summary of the files stored on the server.
+func (c *Client) Stats() error {
+	resp, err := c.client.ListStats(context.Background(), &fileservice.ListStatsRequest{})
+	if err != nil {
+		return fmt.Errorf("failed to get stats: %v", err)
+	}
+
+	fmt.Printf("%d files, %d bytes\n", resp.TotalFiles, resp.TotalBytes)
+	if resp.TotalFiles == 0 {
+		return nil
+	}
+
+	fmt.Printf("%-12s | %8s | %12s\n", "Extension", "Files", "Bytes")
+	for _, ext := range resp.Extensions {
+		name := ext.Extension
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Printf("%-12s | %8d | %12d\n", name, ext.Files, ext.Bytes)
+	}
+
+	fmt.Printf("largest: %v (%d bytes)\n", resp.Largest.Filename, resp.Largest.SizeBytes)
+	fmt.Printf("oldest: %v (created %v)\n", resp.Oldest.Filename, resp.Oldest.CreatedAt)
+
+	return nil
+}
+
+// WatchStats prints a row of the server's activity every interval until ctx
+// is cancelled. The server raises intervals below its minimum.
+func (c *Client) WatchStats(ctx context.Context, interval time.Duration) error {
+	stream, err := c.client.StreamStats(ctx, &fileservice.StreamStatsRequest{
+		IntervalMs: uint32(interval.Milliseconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch stats: %v", err)
+	}
+
+	fmt.Printf("%-20s | %7s | %9s | %5s | %8s | %14s\n",
+		"Time", "Uploads", "Downloads", "Lists", "Files", "Bytes")
+	for {
+		snap, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive stats: %v", err)
+		}
+
+		fmt.Printf("%-20s | %7d | %9d | %5d | %8d | %14d\n", snap.Time,
+			snap.ActiveUploads, snap.ActiveDownloads, snap.ActiveLists, snap.TotalFiles, snap.TotalBytes)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// WithCACert connects over TLS, trusting server certificates signed by the
+// CA in caFile. Without it the connection is plaintext.
+func WithCACert(caFile string) Option {
+	return func(c *Client) {
+		c.caFile = caFile
+	}
+}
+
+// transportCredentials returns TLS credentials trusting the CA in caFile, or
+// insecure credentials if caFile is empty.
+func transportCredentials(caFile string) (credentials.TransportCredentials, error) {
+	if caFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	creds, err := credentials.NewClientTLSFromFile(caFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate: %v", err)
+	}
+
+	return creds, nil
+}
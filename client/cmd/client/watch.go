@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchDebounce is how long a directory must stay quiet before pending
+// changes are uploaded, so a file being written is sent once, not per write.
+const watchDebounce = 500 * time.Millisecond
+
+// Watch uploads every file in dir, then keeps uploading new and changed files
+// until ctx is cancelled. Files whose content has not changed since the last
+// upload are skipped. Deletions are reported but not mirrored, since the
+// server has no way to delete a file.
+func (c *Client) Watch(ctx context.Context, dir string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(dir); err != nil {
+		return fmt.Errorf("failed to watch directory: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory: %v", err)
+	}
+
+	uploaded := make(map[string][sha256.Size]byte)
+	pending := make(map[string]struct{})
+	for _, entry := range entries {
+		pending[filepath.Join(dir, entry.Name())] = struct{}{}
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	fmt.Printf("watching '%v', press Ctrl+C to stop\n", dir)
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("stopped watching")
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("watch error: %s\n", err)
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+
+			switch {
+			case event.Has(fsnotify.Create), event.Has(fsnotify.Write):
+				pending[event.Name] = struct{}{}
+				timer.Reset(watchDebounce)
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				delete(pending, event.Name)
+				if _, ok := uploaded[event.Name]; ok {
+					delete(uploaded, event.Name)
+					fmt.Printf("file '%v' removed locally, deletion is not mirrored to the server\n", filepath.Base(event.Name))
+				}
+			}
+
+		case <-timer.C:
+			for path := range pending {
+				if err := c.syncFile(path, uploaded); err != nil {
+					fmt.Printf("upload failed: %s\n", err)
+				}
+			}
+			clear(pending)
+		}
+	}
+}
+
+// syncFile uploads path unless it is not a regular file or its content
+// matches what was last uploaded.
+func (c *Client) syncFile(path string, uploaded map[string][sha256.Size]byte) error {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	if prev, ok := uploaded[path]; ok && prev == sum {
+		return nil
+	}
+
+	// the watched directory is the source of truth, changes replace the
+	// server's copy
+	if err := c.UploadFile(path, true); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	uploaded[path] = sum
+	return nil
+}
+
+func fileChecksum(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, fmt.Errorf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return sum, fmt.Errorf("failed to read file: %v", err)
+	}
+	copy(sum[:], h.Sum(nil))
+
+	return sum, nil
+}
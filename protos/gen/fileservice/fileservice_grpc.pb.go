@@ -19,9 +19,26 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	FileService_UploadFile_FullMethodName   = "/fileservice.FileService/UploadFile"
-	FileService_DownloadFile_FullMethodName = "/fileservice.FileService/DownloadFile"
-	FileService_ListFiles_FullMethodName    = "/fileservice.FileService/ListFiles"
+	FileService_UploadFile_FullMethodName         = "/fileservice.FileService/UploadFile"
+	FileService_GetUploadOffset_FullMethodName    = "/fileservice.FileService/GetUploadOffset"
+	FileService_DownloadFile_FullMethodName       = "/fileservice.FileService/DownloadFile"
+	FileService_DownloadByChecksum_FullMethodName = "/fileservice.FileService/DownloadByChecksum"
+	FileService_FindByChecksum_FullMethodName     = "/fileservice.FileService/FindByChecksum"
+	FileService_ListFiles_FullMethodName          = "/fileservice.FileService/ListFiles"
+	FileService_ListFilesStream_FullMethodName    = "/fileservice.FileService/ListFilesStream"
+	FileService_BatchStat_FullMethodName          = "/fileservice.FileService/BatchStat"
+	FileService_GetFileInfo_FullMethodName        = "/fileservice.FileService/GetFileInfo"
+	FileService_RenameFile_FullMethodName         = "/fileservice.FileService/RenameFile"
+	FileService_CopyFile_FullMethodName           = "/fileservice.FileService/CopyFile"
+	FileService_ListStats_FullMethodName          = "/fileservice.FileService/ListStats"
+	FileService_StreamStats_FullMethodName        = "/fileservice.FileService/StreamStats"
+	FileService_ListQuarantine_FullMethodName     = "/fileservice.FileService/ListQuarantine"
+	FileService_GetPreview_FullMethodName         = "/fileservice.FileService/GetPreview"
+	FileService_GetHexdump_FullMethodName         = "/fileservice.FileService/GetHexdump"
+	FileService_Session_FullMethodName            = "/fileservice.FileService/Session"
+	FileService_UploadTransaction_FullMethodName  = "/fileservice.FileService/UploadTransaction"
+	FileService_SetMaintenanceMode_FullMethodName = "/fileservice.FileService/SetMaintenanceMode"
+	FileService_GetMaintenanceMode_FullMethodName = "/fileservice.FileService/GetMaintenanceMode"
 )
 
 // FileServiceClient is the client API for FileService service.
@@ -29,8 +46,57 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type FileServiceClient interface {
 	UploadFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadResponse], error)
+	// GetUploadOffset returns how many bytes of an interrupted resumable
+	// upload are stored, i.e. the offset to resume from.
+	GetUploadOffset(ctx context.Context, in *UploadOffsetRequest, opts ...grpc.CallOption) (*UploadOffsetResponse, error)
 	DownloadFile(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error)
+	// DownloadByChecksum downloads a file by the SHA-256 of its content
+	// instead of its name. If several files share the content the first by
+	// name is sent; its name is in the first response.
+	DownloadByChecksum(ctx context.Context, in *DownloadByChecksumRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error)
+	// FindByChecksum returns every file whose content has the given SHA-256.
+	FindByChecksum(ctx context.Context, in *FindByChecksumRequest, opts ...grpc.CallOption) (*FindByChecksumResponse, error)
 	ListFiles(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// ListFilesStream sends files one at a time in filename order. A client
+	// that disconnects can resume by passing the last filename it received
+	// as start_after.
+	ListFilesStream(ctx context.Context, in *ListStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[File], error)
+	// BatchStat returns the metadata of many files in one call. A missing
+	// file is reported in its own entry instead of failing the call.
+	BatchStat(ctx context.Context, in *BatchStatRequest, opts ...grpc.CallOption) (*BatchStatResponse, error)
+	// GetFileInfo returns the metadata of a single file, NOT_FOUND if it
+	// does not exist.
+	GetFileInfo(ctx context.Context, in *GetFileInfoRequest, opts ...grpc.CallOption) (*File, error)
+	// RenameFile moves a file to a new name without transferring it. It fails
+	// with NOT_FOUND if from does not exist and ALREADY_EXISTS if to does.
+	RenameFile(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*File, error)
+	// CopyFile duplicates a file under a new name without transferring it,
+	// and returns the copy. It fails with NOT_FOUND if source does not exist
+	// and ALREADY_EXISTS if destination does, unless overwrite is set.
+	CopyFile(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*File, error)
+	// ListStats summarizes the store without listing it.
+	ListStats(ctx context.Context, in *ListStatsRequest, opts ...grpc.CallOption) (*ListStatsResponse, error)
+	// StreamStats sends a snapshot of the server's activity right away and
+	// then every interval until the client goes away or the server shuts
+	// down.
+	StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatsSnapshot], error)
+	ListQuarantine(ctx context.Context, in *ListQuarantineRequest, opts ...grpc.CallOption) (*ListQuarantineResponse, error)
+	GetPreview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error)
+	// GetHexdump formats the start of a file as a hexdump, for inspecting
+	// binary files without downloading them.
+	GetHexdump(ctx context.Context, in *HexdumpRequest, opts ...grpc.CallOption) (*HexdumpResponse, error)
+	// Session multiplexes small operations over one long-lived stream.
+	// Responses carry the request_id of the request they answer and may
+	// arrive out of order.
+	Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SessionRequest, SessionResponse], error)
+	// UploadTransaction stages several files and publishes all of them on
+	// commit, or none of them on abort or disconnect.
+	UploadTransaction(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransactionRequest, TransactionResponse], error)
+	// SetMaintenanceMode pauses the server: while on, new calls other than
+	// these two fail with UNAVAILABLE and the given message, and health checks
+	// report NOT_SERVING. Calls already running are left to finish.
+	SetMaintenanceMode(ctx context.Context, in *SetMaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceMode, error)
+	GetMaintenanceMode(ctx context.Context, in *GetMaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceMode, error)
 }
 
 type fileServiceClient struct {
@@ -54,6 +120,16 @@ func (c *fileServiceClient) UploadFile(ctx context.Context, opts ...grpc.CallOpt
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_UploadFileClient = grpc.ClientStreamingClient[UploadRequest, UploadResponse]
 
+func (c *fileServiceClient) GetUploadOffset(ctx context.Context, in *UploadOffsetRequest, opts ...grpc.CallOption) (*UploadOffsetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadOffsetResponse)
+	err := c.cc.Invoke(ctx, FileService_GetUploadOffset_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *fileServiceClient) DownloadFile(ctx context.Context, in *DownloadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[1], FileService_DownloadFile_FullMethodName, cOpts...)
@@ -73,6 +149,35 @@ func (c *fileServiceClient) DownloadFile(ctx context.Context, in *DownloadReques
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_DownloadFileClient = grpc.ServerStreamingClient[DownloadResponse]
 
+func (c *fileServiceClient) DownloadByChecksum(ctx context.Context, in *DownloadByChecksumRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DownloadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[2], FileService_DownloadByChecksum_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DownloadByChecksumRequest, DownloadResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadByChecksumClient = grpc.ServerStreamingClient[DownloadResponse]
+
+func (c *fileServiceClient) FindByChecksum(ctx context.Context, in *FindByChecksumRequest, opts ...grpc.CallOption) (*FindByChecksumResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FindByChecksumResponse)
+	err := c.cc.Invoke(ctx, FileService_FindByChecksum_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *fileServiceClient) ListFiles(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(ListResponse)
@@ -83,13 +188,226 @@ func (c *fileServiceClient) ListFiles(ctx context.Context, in *ListRequest, opts
 	return out, nil
 }
 
+func (c *fileServiceClient) ListFilesStream(ctx context.Context, in *ListStreamRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[File], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[3], FileService_ListFilesStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListStreamRequest, File]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_ListFilesStreamClient = grpc.ServerStreamingClient[File]
+
+func (c *fileServiceClient) BatchStat(ctx context.Context, in *BatchStatRequest, opts ...grpc.CallOption) (*BatchStatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchStatResponse)
+	err := c.cc.Invoke(ctx, FileService_BatchStat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetFileInfo(ctx context.Context, in *GetFileInfoRequest, opts ...grpc.CallOption) (*File, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(File)
+	err := c.cc.Invoke(ctx, FileService_GetFileInfo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) RenameFile(ctx context.Context, in *RenameRequest, opts ...grpc.CallOption) (*File, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(File)
+	err := c.cc.Invoke(ctx, FileService_RenameFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) CopyFile(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*File, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(File)
+	err := c.cc.Invoke(ctx, FileService_CopyFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) ListStats(ctx context.Context, in *ListStatsRequest, opts ...grpc.CallOption) (*ListStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListStatsResponse)
+	err := c.cc.Invoke(ctx, FileService_ListStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) StreamStats(ctx context.Context, in *StreamStatsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StatsSnapshot], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[4], FileService_StreamStats_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamStatsRequest, StatsSnapshot]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_StreamStatsClient = grpc.ServerStreamingClient[StatsSnapshot]
+
+func (c *fileServiceClient) ListQuarantine(ctx context.Context, in *ListQuarantineRequest, opts ...grpc.CallOption) (*ListQuarantineResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListQuarantineResponse)
+	err := c.cc.Invoke(ctx, FileService_ListQuarantine_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetPreview(ctx context.Context, in *PreviewRequest, opts ...grpc.CallOption) (*PreviewResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PreviewResponse)
+	err := c.cc.Invoke(ctx, FileService_GetPreview_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetHexdump(ctx context.Context, in *HexdumpRequest, opts ...grpc.CallOption) (*HexdumpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HexdumpResponse)
+	err := c.cc.Invoke(ctx, FileService_GetHexdump_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) Session(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SessionRequest, SessionResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[5], FileService_Session_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SessionRequest, SessionResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_SessionClient = grpc.BidiStreamingClient[SessionRequest, SessionResponse]
+
+func (c *fileServiceClient) UploadTransaction(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TransactionRequest, TransactionResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileService_ServiceDesc.Streams[6], FileService_UploadTransaction_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TransactionRequest, TransactionResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_UploadTransactionClient = grpc.BidiStreamingClient[TransactionRequest, TransactionResponse]
+
+func (c *fileServiceClient) SetMaintenanceMode(ctx context.Context, in *SetMaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceMode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MaintenanceMode)
+	err := c.cc.Invoke(ctx, FileService_SetMaintenanceMode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileServiceClient) GetMaintenanceMode(ctx context.Context, in *GetMaintenanceModeRequest, opts ...grpc.CallOption) (*MaintenanceMode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MaintenanceMode)
+	err := c.cc.Invoke(ctx, FileService_GetMaintenanceMode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FileServiceServer is the server API for FileService service.
 // All implementations must embed UnimplementedFileServiceServer
 // for forward compatibility.
 type FileServiceServer interface {
 	UploadFile(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error
+	// GetUploadOffset returns how many bytes of an interrupted resumable
+	// upload are stored, i.e. the offset to resume from.
+	GetUploadOffset(context.Context, *UploadOffsetRequest) (*UploadOffsetResponse, error)
 	DownloadFile(*DownloadRequest, grpc.ServerStreamingServer[DownloadResponse]) error
+	// DownloadByChecksum downloads a file by the SHA-256 of its content
+	// instead of its name. If several files share the content the first by
+	// name is sent; its name is in the first response.
+	DownloadByChecksum(*DownloadByChecksumRequest, grpc.ServerStreamingServer[DownloadResponse]) error
+	// FindByChecksum returns every file whose content has the given SHA-256.
+	FindByChecksum(context.Context, *FindByChecksumRequest) (*FindByChecksumResponse, error)
 	ListFiles(context.Context, *ListRequest) (*ListResponse, error)
+	// ListFilesStream sends files one at a time in filename order. A client
+	// that disconnects can resume by passing the last filename it received
+	// as start_after.
+	ListFilesStream(*ListStreamRequest, grpc.ServerStreamingServer[File]) error
+	// BatchStat returns the metadata of many files in one call. A missing
+	// file is reported in its own entry instead of failing the call.
+	BatchStat(context.Context, *BatchStatRequest) (*BatchStatResponse, error)
+	// GetFileInfo returns the metadata of a single file, NOT_FOUND if it
+	// does not exist.
+	GetFileInfo(context.Context, *GetFileInfoRequest) (*File, error)
+	// RenameFile moves a file to a new name without transferring it. It fails
+	// with NOT_FOUND if from does not exist and ALREADY_EXISTS if to does.
+	RenameFile(context.Context, *RenameRequest) (*File, error)
+	// CopyFile duplicates a file under a new name without transferring it,
+	// and returns the copy. It fails with NOT_FOUND if source does not exist
+	// and ALREADY_EXISTS if destination does, unless overwrite is set.
+	CopyFile(context.Context, *CopyRequest) (*File, error)
+	// ListStats summarizes the store without listing it.
+	ListStats(context.Context, *ListStatsRequest) (*ListStatsResponse, error)
+	// StreamStats sends a snapshot of the server's activity right away and
+	// then every interval until the client goes away or the server shuts
+	// down.
+	StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[StatsSnapshot]) error
+	ListQuarantine(context.Context, *ListQuarantineRequest) (*ListQuarantineResponse, error)
+	GetPreview(context.Context, *PreviewRequest) (*PreviewResponse, error)
+	// GetHexdump formats the start of a file as a hexdump, for inspecting
+	// binary files without downloading them.
+	GetHexdump(context.Context, *HexdumpRequest) (*HexdumpResponse, error)
+	// Session multiplexes small operations over one long-lived stream.
+	// Responses carry the request_id of the request they answer and may
+	// arrive out of order.
+	Session(grpc.BidiStreamingServer[SessionRequest, SessionResponse]) error
+	// UploadTransaction stages several files and publishes all of them on
+	// commit, or none of them on abort or disconnect.
+	UploadTransaction(grpc.BidiStreamingServer[TransactionRequest, TransactionResponse]) error
+	// SetMaintenanceMode pauses the server: while on, new calls other than
+	// these two fail with UNAVAILABLE and the given message, and health checks
+	// report NOT_SERVING. Calls already running are left to finish.
+	SetMaintenanceMode(context.Context, *SetMaintenanceModeRequest) (*MaintenanceMode, error)
+	GetMaintenanceMode(context.Context, *GetMaintenanceModeRequest) (*MaintenanceMode, error)
 	mustEmbedUnimplementedFileServiceServer()
 }
 
@@ -103,12 +421,63 @@ type UnimplementedFileServiceServer struct{}
 func (UnimplementedFileServiceServer) UploadFile(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
 }
+func (UnimplementedFileServiceServer) GetUploadOffset(context.Context, *UploadOffsetRequest) (*UploadOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUploadOffset not implemented")
+}
 func (UnimplementedFileServiceServer) DownloadFile(*DownloadRequest, grpc.ServerStreamingServer[DownloadResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method DownloadFile not implemented")
 }
+func (UnimplementedFileServiceServer) DownloadByChecksum(*DownloadByChecksumRequest, grpc.ServerStreamingServer[DownloadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadByChecksum not implemented")
+}
+func (UnimplementedFileServiceServer) FindByChecksum(context.Context, *FindByChecksumRequest) (*FindByChecksumResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindByChecksum not implemented")
+}
 func (UnimplementedFileServiceServer) ListFiles(context.Context, *ListRequest) (*ListResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
 }
+func (UnimplementedFileServiceServer) ListFilesStream(*ListStreamRequest, grpc.ServerStreamingServer[File]) error {
+	return status.Errorf(codes.Unimplemented, "method ListFilesStream not implemented")
+}
+func (UnimplementedFileServiceServer) BatchStat(context.Context, *BatchStatRequest) (*BatchStatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchStat not implemented")
+}
+func (UnimplementedFileServiceServer) GetFileInfo(context.Context, *GetFileInfoRequest) (*File, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFileInfo not implemented")
+}
+func (UnimplementedFileServiceServer) RenameFile(context.Context, *RenameRequest) (*File, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameFile not implemented")
+}
+func (UnimplementedFileServiceServer) CopyFile(context.Context, *CopyRequest) (*File, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CopyFile not implemented")
+}
+func (UnimplementedFileServiceServer) ListStats(context.Context, *ListStatsRequest) (*ListStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListStats not implemented")
+}
+func (UnimplementedFileServiceServer) StreamStats(*StreamStatsRequest, grpc.ServerStreamingServer[StatsSnapshot]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamStats not implemented")
+}
+func (UnimplementedFileServiceServer) ListQuarantine(context.Context, *ListQuarantineRequest) (*ListQuarantineResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuarantine not implemented")
+}
+func (UnimplementedFileServiceServer) GetPreview(context.Context, *PreviewRequest) (*PreviewResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPreview not implemented")
+}
+func (UnimplementedFileServiceServer) GetHexdump(context.Context, *HexdumpRequest) (*HexdumpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHexdump not implemented")
+}
+func (UnimplementedFileServiceServer) Session(grpc.BidiStreamingServer[SessionRequest, SessionResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Session not implemented")
+}
+func (UnimplementedFileServiceServer) UploadTransaction(grpc.BidiStreamingServer[TransactionRequest, TransactionResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadTransaction not implemented")
+}
+func (UnimplementedFileServiceServer) SetMaintenanceMode(context.Context, *SetMaintenanceModeRequest) (*MaintenanceMode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMaintenanceMode not implemented")
+}
+func (UnimplementedFileServiceServer) GetMaintenanceMode(context.Context, *GetMaintenanceModeRequest) (*MaintenanceMode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMaintenanceMode not implemented")
+}
 func (UnimplementedFileServiceServer) mustEmbedUnimplementedFileServiceServer() {}
 func (UnimplementedFileServiceServer) testEmbeddedByValue()                     {}
 
@@ -137,6 +506,24 @@ func _FileService_UploadFile_Handler(srv interface{}, stream grpc.ServerStream)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_UploadFileServer = grpc.ClientStreamingServer[UploadRequest, UploadResponse]
 
+func _FileService_GetUploadOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UploadOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetUploadOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetUploadOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetUploadOffset(ctx, req.(*UploadOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _FileService_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(DownloadRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -148,6 +535,35 @@ func _FileService_DownloadFile_Handler(srv interface{}, stream grpc.ServerStream
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileService_DownloadFileServer = grpc.ServerStreamingServer[DownloadResponse]
 
+func _FileService_DownloadByChecksum_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadByChecksumRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).DownloadByChecksum(m, &grpc.GenericServerStream[DownloadByChecksumRequest, DownloadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_DownloadByChecksumServer = grpc.ServerStreamingServer[DownloadResponse]
+
+func _FileService_FindByChecksum_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindByChecksumRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).FindByChecksum(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_FindByChecksum_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).FindByChecksum(ctx, req.(*FindByChecksumRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _FileService_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ListRequest)
 	if err := dec(in); err != nil {
@@ -166,6 +582,222 @@ func _FileService_ListFiles_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _FileService_ListFilesStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).ListFilesStream(m, &grpc.GenericServerStream[ListStreamRequest, File]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_ListFilesStreamServer = grpc.ServerStreamingServer[File]
+
+func _FileService_BatchStat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchStatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).BatchStat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_BatchStat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).BatchStat(ctx, req.(*BatchStatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetFileInfo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFileInfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetFileInfo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetFileInfo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetFileInfo(ctx, req.(*GetFileInfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_RenameFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).RenameFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_RenameFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).RenameFile(ctx, req.(*RenameRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_CopyFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).CopyFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_CopyFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).CopyFile(ctx, req.(*CopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_ListStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).ListStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_ListStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).ListStats(ctx, req.(*ListStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_StreamStats_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamStatsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileServiceServer).StreamStats(m, &grpc.GenericServerStream[StreamStatsRequest, StatsSnapshot]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_StreamStatsServer = grpc.ServerStreamingServer[StatsSnapshot]
+
+func _FileService_ListQuarantine_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuarantineRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).ListQuarantine(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_ListQuarantine_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).ListQuarantine(ctx, req.(*ListQuarantineRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetPreview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetPreview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetPreview_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetPreview(ctx, req.(*PreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetHexdump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HexdumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetHexdump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetHexdump_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetHexdump(ctx, req.(*HexdumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServiceServer).Session(&grpc.GenericServerStream[SessionRequest, SessionResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_SessionServer = grpc.BidiStreamingServer[SessionRequest, SessionResponse]
+
+func _FileService_UploadTransaction_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileServiceServer).UploadTransaction(&grpc.GenericServerStream[TransactionRequest, TransactionResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileService_UploadTransactionServer = grpc.BidiStreamingServer[TransactionRequest, TransactionResponse]
+
+func _FileService_SetMaintenanceMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMaintenanceModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).SetMaintenanceMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_SetMaintenanceMode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).SetMaintenanceMode(ctx, req.(*SetMaintenanceModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileService_GetMaintenanceMode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMaintenanceModeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileServiceServer).GetMaintenanceMode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileService_GetMaintenanceMode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileServiceServer).GetMaintenanceMode(ctx, req.(*GetMaintenanceModeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // FileService_ServiceDesc is the grpc.ServiceDesc for FileService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -173,10 +805,58 @@ var FileService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "fileservice.FileService",
 	HandlerType: (*FileServiceServer)(nil),
 	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUploadOffset",
+			Handler:    _FileService_GetUploadOffset_Handler,
+		},
+		{
+			MethodName: "FindByChecksum",
+			Handler:    _FileService_FindByChecksum_Handler,
+		},
 		{
 			MethodName: "ListFiles",
 			Handler:    _FileService_ListFiles_Handler,
 		},
+		{
+			MethodName: "BatchStat",
+			Handler:    _FileService_BatchStat_Handler,
+		},
+		{
+			MethodName: "GetFileInfo",
+			Handler:    _FileService_GetFileInfo_Handler,
+		},
+		{
+			MethodName: "RenameFile",
+			Handler:    _FileService_RenameFile_Handler,
+		},
+		{
+			MethodName: "CopyFile",
+			Handler:    _FileService_CopyFile_Handler,
+		},
+		{
+			MethodName: "ListStats",
+			Handler:    _FileService_ListStats_Handler,
+		},
+		{
+			MethodName: "ListQuarantine",
+			Handler:    _FileService_ListQuarantine_Handler,
+		},
+		{
+			MethodName: "GetPreview",
+			Handler:    _FileService_GetPreview_Handler,
+		},
+		{
+			MethodName: "GetHexdump",
+			Handler:    _FileService_GetHexdump_Handler,
+		},
+		{
+			MethodName: "SetMaintenanceMode",
+			Handler:    _FileService_SetMaintenanceMode_Handler,
+		},
+		{
+			MethodName: "GetMaintenanceMode",
+			Handler:    _FileService_GetMaintenanceMode_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -189,6 +869,33 @@ var FileService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _FileService_DownloadFile_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "DownloadByChecksum",
+			Handler:       _FileService_DownloadByChecksum_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListFilesStream",
+			Handler:       _FileService_ListFilesStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamStats",
+			Handler:       _FileService_StreamStats_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Session",
+			Handler:       _FileService_Session_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "UploadTransaction",
+			Handler:       _FileService_UploadTransaction_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "fileservice/fileservice.proto",
 }
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"server/internal/config"
 	"server/internal/server"
+	"syscall"
 )
 
 const (
@@ -23,7 +26,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := server.Start(cfg, log); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.Start(ctx, cfg, log); err != nil {
 		log.Error("failed to start gRPC server", "error", err)
 		os.Exit(1)
 	}
@@ -3,19 +3,53 @@ package config
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env       string `yaml:"env"`
-	Port      int    `yaml:"port"`
-	UploadDir string `yaml:"upload_dir"`
-	Limits    struct {
-		Upload   int `yaml:"upload"`
-		Download int `yaml:"download"`
-		List     int `yaml:"list"`
+	Env                  string        `yaml:"env"`
+	Port                 int           `yaml:"port"`
+	MetricsPort          int           `yaml:"metrics_port"`
+	UploadDir            string        `yaml:"upload_dir"`
+	DirMode              string        `yaml:"dir_mode"`
+	FileMode             string        `yaml:"file_mode"`
+	ChunkSize            int           `yaml:"chunk_size"`
+	TLSCertFile          string        `yaml:"tls_cert_file"`
+	TLSKeyFile           string        `yaml:"tls_key_file"`
+	EncryptionKey        string        `yaml:"encryption_key" env:"ENCRYPTION_KEY"`
+	ReadOnly             bool          `yaml:"read_only"`
+	HideDotfiles         bool          `yaml:"hide_dotfiles"`
+	SanitizeFilenames    bool          `yaml:"sanitize_filenames"`
+	CaseInsensitiveNames bool          `yaml:"case_insensitive_names"`
+	StrictContentType    bool          `yaml:"strict_content_type"`
+	SnapshotInterval     time.Duration `yaml:"snapshot_interval"`
+	MetadataWAL          bool          `yaml:"metadata_wal"`
+	MetadataShards       int           `yaml:"metadata_shards"`
+	PreviewMaxDimension  int           `yaml:"preview_max_dimension"`
+	HexdumpMaxBytes      int           `yaml:"hexdump_max_bytes"`
+	PartialUploadMaxAge  time.Duration `yaml:"partial_upload_max_age"`
+	ShutdownTimeout      time.Duration `yaml:"shutdown_timeout"`
+	BackfillContentTypes bool          `yaml:"backfill_content_types"`
+	AllowedExtensions    []string      `yaml:"allowed_extensions"`
+	APIKeys              []string      `yaml:"api_keys" env:"API_KEYS"`
+	Limits               struct {
+		Upload             int           `yaml:"upload"`
+		Download           int           `yaml:"download"`
+		List               int           `yaml:"list"`
+		LargeList          int           `yaml:"large_list"`
+		LargeListThreshold int           `yaml:"large_list_threshold"`
+		MaxFileSize        int64         `yaml:"max_file_size"`
+		MinFreeInodes      uint64        `yaml:"min_free_inodes"`
+		UploadTimeout      time.Duration `yaml:"upload_timeout"`
+		RequestsPerSecond  float64       `yaml:"requests_per_second"`
+		Burst              int           `yaml:"burst"`
 	} `yaml:"limits"`
+	Methods struct {
+		Enabled  []string `yaml:"enabled"`
+		Disabled []string `yaml:"disabled"`
+	} `yaml:"methods"`
 }
 
 func MustLoad() *Config {
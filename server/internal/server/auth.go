@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"server/internal/service"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyHeader is the metadata key a client may send its API key in, as an
+// alternative to "authorization: Bearer <key>".
+const apiKeyHeader = "x-api-key"
+
+var (
+	errMissingKey = status.Error(codes.Unauthenticated, "missing API key")
+	errInvalidKey = status.Error(codes.Unauthenticated, "invalid API key")
+)
+
+// apiKeys rejects calls that do not carry one of the configured API keys.
+// Keys are configured as hex encoded SHA-256 digests, so the config never
+// holds a usable key, and a presented key is hashed and compared against
+// every digest in constant time. Health checks are let through so load
+// balancers need no key.
+type apiKeys struct {
+	digests [][]byte
+	log     *slog.Logger
+}
+
+func newAPIKeys(digests []string, log *slog.Logger) (*apiKeys, error) {
+	a := &apiKeys{log: log}
+	for i, d := range digests {
+		digest, err := hex.DecodeString(strings.TrimSpace(d))
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("API key %d is not a hex encoded SHA-256 digest", i+1)
+		}
+		a.digests = append(a.digests, digest)
+	}
+	return a, nil
+}
+
+// presentedKey returns the API key sent with the call, or "" if none is.
+func presentedKey(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if keys := md.Get(apiKeyHeader); len(keys) > 0 {
+		return keys[0]
+	}
+	for _, auth := range md.Get("authorization") {
+		if scheme, key, ok := strings.Cut(auth, " "); ok && strings.EqualFold(scheme, "bearer") {
+			return strings.TrimSpace(key)
+		}
+	}
+	return ""
+}
+
+func (a *apiKeys) check(ctx context.Context, method string) error {
+	if isHealthCheck(method) {
+		return nil
+	}
+
+	key := presentedKey(ctx)
+	if key == "" {
+		service.LoggerFrom(ctx, a.log).Warn("rejected call without API key")
+		return errMissingKey
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	match := 0
+	for _, digest := range a.digests {
+		match |= subtle.ConstantTimeCompare(sum[:], digest)
+	}
+	if match == 0 {
+		service.LoggerFrom(ctx, a.log).Warn("rejected call with invalid API key")
+		return errInvalidKey
+	}
+	return nil
+}
+
+func (a *apiKeys) unary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+
+	if err := a.check(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *apiKeys) stream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+
+	if err := a.check(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
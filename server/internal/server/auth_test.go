@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testAPIKey     = "s3cret"
+	testMethod     = "/fileservice.FileService/ListFiles"
+	testHealthPath = "/grpc.health.v1.Health/Check"
+)
+
+func newTestAPIKeys(t *testing.T) *apiKeys {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(testAPIKey))
+	a, err := newAPIKeys([]string{hex.EncodeToString(sum[:])}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("newAPIKeys: %v", err)
+	}
+	return a
+}
+
+func withMetadata(kv ...string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(kv...))
+}
+
+func TestAPIKeysCheck(t *testing.T) {
+	a := newTestAPIKeys(t)
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"missing key", context.Background(), testMethod, codes.Unauthenticated},
+		{"empty metadata", withMetadata(), testMethod, codes.Unauthenticated},
+		{"wrong key", withMetadata(apiKeyHeader, "wrong"), testMethod, codes.Unauthenticated},
+		{"wrong bearer token", withMetadata("authorization", "Bearer wrong"), testMethod, codes.Unauthenticated},
+		{"valid key", withMetadata(apiKeyHeader, testAPIKey), testMethod, codes.OK},
+		{"valid bearer token", withMetadata("authorization", "bearer "+testAPIKey), testMethod, codes.OK},
+		{"health check without key", context.Background(), testHealthPath, codes.OK},
+	}
+	for _, tt := range tests {
+		if err := a.check(tt.ctx, tt.method); status.Code(err) != tt.want {
+			t.Errorf("%s: check = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if err := a.check(context.Background(), testMethod); err != errMissingKey {
+		t.Errorf("missing key: check = %v, want %v", err, errMissingKey)
+	}
+	if err := a.check(withMetadata(apiKeyHeader, "wrong"), testMethod); err != errInvalidKey {
+		t.Errorf("wrong key: check = %v, want %v", err, errInvalidKey)
+	}
+}
+
+func TestNewAPIKeysInvalidDigest(t *testing.T) {
+	for _, digest := range []string{"", "not hex", "abcd"} {
+		if _, err := newAPIKeys([]string{digest}, slog.New(slog.DiscardHandler)); err == nil {
+			t.Errorf("newAPIKeys(%q) succeeded, want an error", digest)
+		}
+	}
+}
+
+func TestAPIKeysUnary(t *testing.T) {
+	a := newTestAPIKeys(t)
+
+	called := false
+	handler := func(context.Context, any) (any, error) {
+		called = true
+		return "ok", nil
+	}
+
+	_, err := a.unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+	if status.Code(err) != codes.Unauthenticated || called {
+		t.Errorf("without key: err = %v, handler called = %v; want Unauthenticated, not called", err, called)
+	}
+
+	resp, err := a.unary(withMetadata(apiKeyHeader, testAPIKey), nil, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+	if err != nil || resp != "ok" {
+		t.Errorf("with valid key: resp = %v, err = %v; want ok", resp, err)
+	}
+
+	called = false
+	if _, err := a.unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: testHealthPath}, handler); err != nil || !called {
+		t.Errorf("health check: err = %v, handler called = %v; want nil, called", err, called)
+	}
+}
+
+// testStream is a server stream carrying only a context.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAPIKeysStream(t *testing.T) {
+	a := newTestAPIKeys(t)
+
+	called := false
+	handler := func(any, grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/fileservice.FileService/DownloadFile"}
+
+	err := a.stream(nil, testStream{ctx: withMetadata(apiKeyHeader, "wrong")}, info, handler)
+	if status.Code(err) != codes.Unauthenticated || called {
+		t.Errorf("wrong key: err = %v, handler called = %v; want Unauthenticated, not called", err, called)
+	}
+
+	if err := a.stream(nil, testStream{ctx: withMetadata(apiKeyHeader, testAPIKey)}, info, handler); err != nil || !called {
+		t.Errorf("valid key: err = %v, handler called = %v; want nil, called", err, called)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import "sync"
+
+// chunkBuffers hands out the buffers downloads are read into. Full-size
+// buffers are pooled and shared across streams, while files smaller than a
+// chunk get a buffer sized to the file, so many concurrent small downloads
+// do not each hold a whole chunk.
+type chunkBuffers struct {
+	size int
+	pool sync.Pool
+}
+
+func newChunkBuffers(size int) *chunkBuffers {
+	b := &chunkBuffers{size: size}
+	b.pool.New = func() any {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return b
+}
+
+// get returns a buffer for reading a file of fileSize bytes, -1 if unknown.
+func (b *chunkBuffers) get(fileSize int64) []byte {
+	if fileSize >= 0 && fileSize < int64(b.size) {
+		// at least one byte, reading into an empty buffer never hits EOF
+		return make([]byte, max(fileSize, 1))
+	}
+	return *b.pool.Get().(*[]byte)
+}
+
+// put returns a buffer from get once it is no longer used.
+func (b *chunkBuffers) put(buf []byte) {
+	if len(buf) == b.size {
+		b.pool.Put(&buf)
+	}
+}
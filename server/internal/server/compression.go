@@ -0,0 +1,42 @@
+package server
+
+import (
+	gz "compress/gzip"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"io"
+	"slices"
+)
+
+// compressListMin is the number of files from which a listing is sent gzip
+// compressed. Below it the compression overhead outweighs the savings.
+const compressListMin = 100
+
+// compressResponse asks for the response to be gzip compressed if the client
+// advertised support for it. It reports whether compression was enabled.
+func compressResponse(ctx context.Context) bool {
+	accepted, err := grpc.ClientSupportedCompressors(ctx)
+	if err != nil || !slices.Contains(accepted, gzip.Name) {
+		return false
+	}
+
+	return grpc.SetSendCompressor(ctx, gzip.Name) == nil
+}
+
+// gzipReader returns the gzip compressed content of r. Closing it stops the
+// compression early.
+func gzipReader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		zw := gz.NewWriter(pw)
+		_, err := io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
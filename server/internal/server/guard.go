@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"protos/gen/fileservice"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mutatingMethods are the RPCs rejected in read-only mode.
+var mutatingMethods = map[string]bool{
+	fileservice.FileService_UploadFile_FullMethodName:        true,
+	fileservice.FileService_UploadTransaction_FullMethodName: true,
+	fileservice.FileService_RenameFile_FullMethodName:        true,
+	fileservice.FileService_CopyFile_FullMethodName:          true,
+}
+
+// methodDependencies lists methods whose functionality is also reachable
+// through another method, which must not stay enabled when they are disabled.
+var methodDependencies = map[string][]string{
+	"Session":            {"ListFiles", "DownloadFile", "GetFileInfo"},
+	"DownloadByChecksum": {"DownloadFile"},
+	"ListFilesStream":    {"ListFiles"},
+	"BatchStat":          {"ListFiles"},
+}
+
+var errReadOnly = status.Error(codes.FailedPrecondition, "server is in read-only mode")
+
+// methodGuard rejects calls to the methods it holds with the mapped error.
+type methodGuard map[string]error
+
+// newMethodGuard builds the guard for read-only mode and the enabled and
+// disabled method lists. Methods are given by their short name, e.g.
+// "UploadFile". An empty enabled list enables every method.
+func newMethodGuard(readOnly bool, enabled, disabled []string) (methodGuard, error) {
+	known := make(map[string]bool)
+	for _, m := range fileservice.FileService_ServiceDesc.Methods {
+		known[m.MethodName] = true
+	}
+	for _, s := range fileservice.FileService_ServiceDesc.Streams {
+		known[s.StreamName] = true
+	}
+
+	off := make(map[string]bool)
+	if len(enabled) > 0 {
+		for name := range known {
+			off[name] = true
+		}
+		for _, name := range enabled {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown method %q in enabled methods", name)
+			}
+			delete(off, name)
+		}
+	}
+	for _, name := range disabled {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown method %q in disabled methods", name)
+		}
+		off[name] = true
+	}
+
+	for name, deps := range methodDependencies {
+		if off[name] {
+			continue
+		}
+		for _, dep := range deps {
+			if off[dep] {
+				return nil, fmt.Errorf("method %s must be disabled when %s is disabled", name, dep)
+			}
+		}
+	}
+
+	g := make(methodGuard)
+	if readOnly {
+		for method := range mutatingMethods {
+			g[method] = errReadOnly
+		}
+	}
+	for name := range off {
+		method := fmt.Sprintf("/%s/%s", fileservice.FileService_ServiceDesc.ServiceName, name)
+		g[method] = status.Errorf(codes.Unimplemented, "method %s is disabled", name)
+	}
+
+	return g, nil
+}
+
+// names returns the short names of the guarded methods.
+func (g methodGuard) names() []string {
+	names := make([]string, 0, len(g))
+	for method := range g {
+		names = append(names, method[strings.LastIndex(method, "/")+1:])
+	}
+	return names
+}
+
+func (g methodGuard) unary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+
+	if err, ok := g[info.FullMethod]; ok {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (g methodGuard) stream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+
+	if err, ok := g[info.FullMethod]; ok {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"protos/gen/fileservice"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const defaultMaintenanceMessage = "server is in maintenance mode"
+
+// maintenanceExempt are the methods still served in maintenance mode, so
+// it can be inspected and turned off again. Health checks are served too
+// and report NOT_SERVING.
+var maintenanceExempt = map[string]bool{
+	fileservice.FileService_SetMaintenanceMode_FullMethodName: true,
+	fileservice.FileService_GetMaintenanceMode_FullMethodName: true,
+}
+
+// maintenance rejects new calls with UNAVAILABLE while maintenance mode is
+// on. Calls already running are left to finish. A nil *maintenance is never
+// on.
+type maintenance struct {
+	health *health.Server
+
+	mu      sync.RWMutex
+	on      bool
+	message string
+}
+
+func newMaintenance(health *health.Server) *maintenance {
+	return &maintenance{health: health}
+}
+
+// set turns maintenance mode on or off. The file service reports
+// NOT_SERVING to health checks while it is on, so load balancers drain the
+// server.
+func (m *maintenance) set(on bool, message string) {
+	if !on {
+		message = ""
+	} else if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	m.mu.Lock()
+	m.on = on
+	m.message = message
+	m.mu.Unlock()
+
+	serving := healthpb.HealthCheckResponse_SERVING
+	if on {
+		serving = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	m.health.SetServingStatus(fileservice.FileService_ServiceDesc.ServiceName, serving)
+}
+
+func (m *maintenance) get() (on bool, message string) {
+	if m == nil {
+		return false, ""
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.on, m.message
+}
+
+// check returns the error to reject a new call with, if any.
+func (m *maintenance) check() error {
+	if on, message := m.get(); on {
+		return status.Error(codes.Unavailable, message)
+	}
+	return nil
+}
+
+func (m *maintenance) unary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+
+	if !maintenanceExempt[info.FullMethod] && !isHealthCheck(info.FullMethod) {
+		if err := m.check(); err != nil {
+			return nil, err
+		}
+	}
+	return handler(ctx, req)
+}
+
+func (m *maintenance) stream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+
+	if !maintenanceExempt[info.FullMethod] && !isHealthCheck(info.FullMethod) {
+		if err := m.check(); err != nil {
+			return err
+		}
+	}
+	return handler(srv, ss)
+}
+
+func (s *FileServer) SetMaintenanceMode(
+	ctx context.Context,
+	req *fileservice.SetMaintenanceModeRequest,
+) (*fileservice.MaintenanceMode, error) {
+
+	if s.maintenance == nil {
+		return nil, status.Error(codes.Unimplemented, "maintenance mode is not available")
+	}
+
+	s.maintenance.set(req.On, req.Message)
+	on, message := s.maintenance.get()
+
+	n := s.fileService.InFlight()
+	s.logger(ctx).Warn("maintenance mode changed", "on", on, "message", message,
+		"uploads", n.Uploads, "downloads", n.Downloads, "lists", n.Lists)
+	return &fileservice.MaintenanceMode{On: on, Message: message}, nil
+}
+
+func (s *FileServer) GetMaintenanceMode(
+	ctx context.Context,
+	req *fileservice.GetMaintenanceModeRequest,
+) (*fileservice.MaintenanceMode, error) {
+
+	on, message := s.maintenance.get()
+	return &fileservice.MaintenanceMode{On: on, Message: message}, nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"server/internal/service"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// metrics records per-RPC request counts, errors and durations, and the
+// bytes moved by uploads and downloads. A nil *metrics records nothing.
+type metrics struct {
+	requests *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	bytes    *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fileservice_requests_total",
+			Help: "RPCs handled, by method.",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fileservice_errors_total",
+			Help: "RPCs that failed, by method and status code.",
+		}, []string{"method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fileservice_request_duration_seconds",
+			Help:    "RPC duration, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+		bytes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fileservice_transfer_bytes",
+			Help:    "Bytes per upload or download.",
+			Buckets: prometheus.ExponentialBuckets(1024, 4, 10), // 1KB to 256MB
+		}, []string{"direction"}),
+	}
+	reg.MustRegister(m.requests, m.errors, m.duration, m.bytes)
+	return m
+}
+
+// observe records a finished RPC.
+func (m *metrics) observe(fullMethod string, start time.Time, err error) {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+
+	m.requests.WithLabelValues(method).Inc()
+	m.duration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+}
+
+// transferred records the size of a completed upload or download.
+func (m *metrics) transferred(direction string, n int64) {
+	if m == nil {
+		return
+	}
+	m.bytes.WithLabelValues(direction).Observe(float64(n))
+}
+
+func (m *metrics) unary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	m.observe(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (m *metrics) stream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+
+	start := time.Now()
+	err := handler(srv, ss)
+	m.observe(info.FullMethod, start, err)
+	return err
+}
+
+// registerQueues exposes how many operations of each kind are waiting for
+// a concurrency slot, read from fs when scraped.
+func registerQueues(reg prometheus.Registerer, fs *service.FileService) {
+	for kind, queued := range map[string]func(service.InFlight) int64{
+		"upload":   func(n service.InFlight) int64 { return n.Uploads },
+		"download": func(n service.InFlight) int64 { return n.Downloads },
+		"list":     func(n service.InFlight) int64 { return n.Lists },
+	} {
+		reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "fileservice_queued_requests",
+			Help:        "Requests waiting for a concurrency slot, by kind.",
+			ConstLabels: prometheus.Labels{"kind": kind},
+		}, func() float64 {
+			return float64(queued(fs.Queued()))
+		}))
+	}
+}
+
+// serveMetrics serves the registry on /metrics at port until ctx is
+// cancelled.
+func serveMetrics(ctx context.Context, port int, reg *prometheus.Registry, log *slog.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Info("serving metrics", "port", port)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("failed to serve metrics", "error", err)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"encoding/base64"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxListPageSize caps the number of files in one ListFiles page.
+const maxListPageSize = 1000
+
+// encodePageToken returns an opaque token resuming a listing after filename.
+func encodePageToken(filename string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(filename))
+}
+
+// decodePageToken returns the filename a page token resumes after. An empty
+// token starts from the beginning.
+func decodePageToken(token string) (string, error) {
+	filename, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid page token")
+	}
+	return string(filename), nil
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func withPeer(ip string, port int) context.Context {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip), Port: port}
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+}
+
+func TestRateLimiterUnary(t *testing.T) {
+	l := newRateLimiter(1, 2)
+
+	calls := 0
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return "ok", nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+
+	for i := range 2 {
+		if _, err := l.unary(withPeer("10.0.0.1", 1000), nil, info, handler); err != nil {
+			t.Fatalf("call %d within the burst: %v", i+1, err)
+		}
+	}
+
+	// a new connection from the same host shares its bucket
+	_, err := l.unary(withPeer("10.0.0.1", 2000), nil, info, handler)
+	if status.Code(err) != codes.ResourceExhausted || calls != 2 {
+		t.Errorf("call over the limit: err = %v, handler calls = %d; want ResourceExhausted, 2", err, calls)
+	}
+
+	if _, err := l.unary(withPeer("10.0.0.2", 1000), nil, info, handler); err != nil {
+		t.Errorf("call from another host: %v", err)
+	}
+
+	health := &grpc.UnaryServerInfo{FullMethod: testHealthPath}
+	if _, err := l.unary(withPeer("10.0.0.1", 1000), nil, health, handler); err != nil {
+		t.Errorf("health check over the limit: %v", err)
+	}
+
+	// a second's worth of tokens lets one more call through
+	l.buckets["10.0.0.1"].last = time.Now().Add(-time.Second)
+	if _, err := l.unary(withPeer("10.0.0.1", 1000), nil, info, handler); err != nil {
+		t.Errorf("call after refill: %v", err)
+	}
+	if _, err := l.unary(withPeer("10.0.0.1", 1000), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second call after refill = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestRateLimiterStream(t *testing.T) {
+	l := newRateLimiter(1, 1)
+
+	calls := 0
+	handler := func(any, grpc.ServerStream) error {
+		calls++
+		return nil
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/fileservice.FileService/DownloadFile"}
+	ss := testStream{ctx: withPeer("10.0.0.1", 1000)}
+
+	if err := l.stream(nil, ss, info, handler); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if err := l.stream(nil, ss, info, handler); status.Code(err) != codes.ResourceExhausted || calls != 1 {
+		t.Errorf("call over the limit: err = %v, handler calls = %d; want ResourceExhausted, 1", err, calls)
+	}
+
+	// calls without a peer share one bucket
+	if err := l.stream(nil, testStream{ctx: context.Background()}, info, handler); err != nil {
+		t.Fatalf("first call without a peer: %v", err)
+	}
+	if err := l.stream(nil, testStream{ctx: context.Background()}, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second call without a peer = %v, want ResourceExhausted", err)
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"server/internal/service"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDHeader is the metadata key carrying the request ID, both from a
+// client that brings its own and back to the client in the response header.
+const requestIDHeader = "x-request-id"
+
+// maxRequestIDLen bounds a client supplied request ID, longer ones are
+// replaced with a generated ID.
+const maxRequestIDLen = 64
+
+// requestIDs tags every call with a request ID: the client's if it sent a
+// usable one, a generated one otherwise. The ID is echoed in the response
+// header and the call's context carries a logger adding it to every
+// message, see service.WithLogger.
+type requestIDs struct {
+	log *slog.Logger
+}
+
+// requestID returns the ID sent by the client, or a new one.
+func requestID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDHeader); len(ids) > 0 && validRequestID(ids[0]) {
+			return ids[0]
+		}
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts IDs of printable ASCII, which are safe to log and
+// to send back as header values.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *requestIDs) tag(ctx context.Context, method string) (context.Context, metadata.MD) {
+	id := requestID(ctx)
+	log := r.log.With("request_id", id, "method", method)
+	return service.WithLogger(ctx, log), metadata.Pairs(requestIDHeader, id)
+}
+
+func (r *requestIDs) unary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+
+	ctx, header := r.tag(ctx, info.FullMethod)
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		r.log.Warn("failed to set request ID header", "error", err)
+	}
+	return handler(ctx, req)
+}
+
+func (r *requestIDs) stream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+
+	ctx, header := r.tag(ss.Context(), info.FullMethod)
+	if err := ss.SetHeader(header); err != nil {
+		r.log.Warn("failed to set request ID header", "error", err)
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextStream is a ServerStream with a replaced context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -2,181 +2,836 @@ package server
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"hash/crc32"
 	"io"
 	"log/slog"
 	"net"
+	"os"
 	"protos/gen/fileservice"
 	"server/internal/config"
 	"server/internal/service"
+	"strconv"
 	"time"
 )
 
 type FileServer struct {
 	fileservice.UnimplementedFileServiceServer
 	fileService *service.FileService
+	metrics     *metrics
 	log         *slog.Logger
+
+	// uploadTimeout bounds each upload and upload transaction, 0 means no
+	// limit.
+	uploadTimeout time.Duration
+	// buffers holds the chunk buffers downloads are sent from.
+	buffers *chunkBuffers
+	// maintenance is switched by SetMaintenanceMode.
+	maintenance *maintenance
+	// stopping is closed when the server starts shutting down, ending
+	// streams that would otherwise run until the client leaves.
+	stopping chan struct{}
 }
 
-func NewFileServer(fileService *service.FileService, log *slog.Logger) *FileServer {
+const (
+	defaultChunkSize = 32 * 1024
+	// maxChunkSize keeps chunks well below gRPC's default 4MB message
+	// limit on the receiving side.
+	maxChunkSize = 1024 * 1024
+	// uploadProgressInterval is how often a running upload logs the bytes
+	// received so far.
+	uploadProgressInterval = 10 * time.Second
+	// defaultStatsInterval and minStatsInterval apply to the interval a
+	// StreamStats client asks for.
+	defaultStatsInterval = 5 * time.Second
+	minStatsInterval     = time.Second
+)
+
+func NewFileServer(
+	fileService *service.FileService,
+	metrics *metrics,
+	maintenance *maintenance,
+	uploadTimeout time.Duration,
+	chunkSize int,
+	log *slog.Logger,
+) *FileServer {
 	return &FileServer{
-		fileService: fileService,
-		log:         log,
+		fileService:   fileService,
+		metrics:       metrics,
+		maintenance:   maintenance,
+		uploadTimeout: uploadTimeout,
+		buffers:       newChunkBuffers(chunkSize),
+		stopping:      make(chan struct{}),
+		log:           log,
 	}
 }
 
-func Start(cfg *config.Config, log *slog.Logger) error {
-	fileService, err := service.New(
-		cfg.UploadDir,
-		int64(cfg.Limits.Upload),
-		int64(cfg.Limits.Download),
-		int64(cfg.Limits.List),
-		log,
-	)
+// logger returns the logger of the call ctx belongs to, tagged with its
+// request ID.
+func (s *FileServer) logger(ctx context.Context) *slog.Logger {
+	return service.LoggerFrom(ctx, s.log)
+}
+
+// Start serves the file service until ctx is cancelled, then stops gracefully
+// and flushes the metadata.
+func Start(ctx context.Context, cfg *config.Config, log *slog.Logger) error {
+	guard, err := newMethodGuard(cfg.ReadOnly, cfg.Methods.Enabled, cfg.Methods.Disabled)
+	if err != nil {
+		return err
+	}
+
+	chunkSize := cfg.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = defaultChunkSize
+	}
+	if chunkSize < 0 || chunkSize > maxChunkSize {
+		return fmt.Errorf("chunk_size must be between 1 and %d, got %d", maxChunkSize, chunkSize)
+	}
+	dirMode, err := parseMode("dir_mode", cfg.DirMode, 0700)
+	if err != nil {
+		return err
+	}
+	fileMode, err := parseMode("file_mode", cfg.FileMode, 0600)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Limits.RequestsPerSecond < 0 {
+		return fmt.Errorf("limits.requests_per_second must not be negative, got %v", cfg.Limits.RequestsPerSecond)
+	}
+
+	var serverOpts []grpc.ServerOption
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+			return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+		}
+
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+
+	var keys service.KeyProvider
+	if cfg.EncryptionKey != "" {
+		key, err := hex.DecodeString(cfg.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("invalid encryption key: %w", err)
+		}
+		keys = service.StaticKey(key)
+	}
+
+	fileService, err := service.New(service.Options{
+		UploadDir:            cfg.UploadDir,
+		UploadLimit:          int64(cfg.Limits.Upload),
+		DownloadLimit:        int64(cfg.Limits.Download),
+		ListLimit:            int64(cfg.Limits.List),
+		LargeListLimit:       int64(cfg.Limits.LargeList),
+		LargeListThreshold:   cfg.Limits.LargeListThreshold,
+		MaxFileSize:          cfg.Limits.MaxFileSize,
+		AllowedExtensions:    cfg.AllowedExtensions,
+		MinFreeInodes:        cfg.Limits.MinFreeInodes,
+		HideDotfiles:         cfg.HideDotfiles,
+		StrictContentType:    cfg.StrictContentType,
+		SnapshotInterval:     cfg.SnapshotInterval,
+		MetadataWAL:          cfg.MetadataWAL,
+		PreviewMaxDimension:  cfg.PreviewMaxDimension,
+		HexdumpMaxBytes:      cfg.HexdumpMaxBytes,
+		CaseInsensitiveNames: cfg.CaseInsensitiveNames,
+		KeyProvider:          keys,
+		SanitizeFilenames:    cfg.SanitizeFilenames,
+		PartialUploadMaxAge:  cfg.PartialUploadMaxAge,
+		MetadataShards:       cfg.MetadataShards,
+		DirMode:              dirMode,
+		FileMode:             fileMode,
+		BackfillContentTypes: cfg.BackfillContentTypes,
+	}, log)
 	if err != nil {
 		return err
 	}
 
+	defer fileService.Close()
+
+	if !cfg.ReadOnly {
+		if err := fileService.CheckWritable(); err != nil {
+			return fmt.Errorf("upload directory is not writable: %w", err)
+		}
+	}
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
 	if err != nil {
 		return err
 	}
 
-	grpcServer := grpc.NewServer()
-	fileServer := NewFileServer(fileService, log)
+	var (
+		unaryInterceptors  []grpc.UnaryServerInterceptor
+		streamInterceptors []grpc.StreamServerInterceptor
+		m                  *metrics
+	)
+	// first, so calls rejected by later interceptors get an ID too
+	requestIDs := &requestIDs{log: log}
+	unaryInterceptors = append(unaryInterceptors, requestIDs.unary)
+	streamInterceptors = append(streamInterceptors, requestIDs.stream)
+
+	if cfg.MetricsPort != 0 {
+		reg := prometheus.NewRegistry()
+		m = newMetrics(reg)
+		registerQueues(reg, fileService)
+		go serveMetrics(ctx, cfg.MetricsPort, reg, log)
+
+		// before the others, so calls rejected by them are counted too
+		unaryInterceptors = append(unaryInterceptors, m.unary)
+		streamInterceptors = append(streamInterceptors, m.stream)
+	}
+	if cfg.Limits.RequestsPerSecond > 0 {
+		log.Info("rate limiting clients",
+			"requests_per_second", cfg.Limits.RequestsPerSecond, "burst", cfg.Limits.Burst)
+		limiter := newRateLimiter(cfg.Limits.RequestsPerSecond, cfg.Limits.Burst)
+
+		// before authentication, so guessing keys is throttled too
+		unaryInterceptors = append(unaryInterceptors, limiter.unary)
+		streamInterceptors = append(streamInterceptors, limiter.stream)
+	}
+	if len(cfg.APIKeys) > 0 {
+		auth, err := newAPIKeys(cfg.APIKeys, log)
+		if err != nil {
+			return err
+		}
+		log.Info("requiring API keys", "keys", len(cfg.APIKeys))
+
+		// before the method guard and maintenance mode, so callers without
+		// a key learn nothing about the server's state
+		unaryInterceptors = append(unaryInterceptors, auth.unary)
+		streamInterceptors = append(streamInterceptors, auth.stream)
+	}
+	if cfg.ReadOnly {
+		log.Info("server is in read-only mode")
+	}
+	if len(guard) > 0 {
+		log.Info("restricting methods", "methods", guard.names())
+		unaryInterceptors = append(unaryInterceptors, guard.unary)
+		streamInterceptors = append(streamInterceptors, guard.stream)
+	}
+
+	healthServer := health.NewServer()
+	maintenance := newMaintenance(healthServer)
+	unaryInterceptors = append(unaryInterceptors, maintenance.unary)
+	streamInterceptors = append(streamInterceptors, maintenance.stream)
+
+	grpcServer := grpc.NewServer(append(serverOpts,
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)...)
+	fileServer := NewFileServer(fileService, m, maintenance, cfg.Limits.UploadTimeout, chunkSize, log)
 	fileservice.RegisterFileServiceServer(grpcServer, fileServer)
 
-	log.Info("server is running", "port", cfg.Port)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	healthServer.SetServingStatus(fileservice.FileService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+
+	log.Info("server is running", "port", cfg.Port, "tls", cfg.TLSCertFile != "", "chunk_size", chunkSize)
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+
+		n := fileService.InFlight()
+		log.Info("shutting down server", "timeout", cfg.ShutdownTimeout,
+			"uploads", n.Uploads, "downloads", n.Downloads, "lists", n.Lists)
+		// report NOT_SERVING while in-flight calls drain
+		healthServer.Shutdown()
+		close(fileServer.stopping)
+		stopGracefully(grpcServer, fileService, cfg.ShutdownTimeout, log)
+	}()
+
+	err = grpcServer.Serve(lis)
+	if ctx.Err() != nil {
+		// Serve returns as soon as stopping begins, wait for in-flight calls
+		// before the metadata is flushed
+		<-shutdownDone
+	}
+	return err
+}
+
+// parseMode parses an octal permission string such as "0750". Empty yields
+// zero, leaving the default to the file service. The mode must not have
+// bits beyond 0777 and must include required, the access the service
+// itself needs.
+func parseMode(name, value string, required os.FileMode) (os.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an octal mode such as \"0755\", got %q", name, value)
+	}
+
+	mode := os.FileMode(n)
+	if mode&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("%s must be at most 0777, got %#o", name, mode)
+	}
+	if mode&required != required {
+		return 0, fmt.Errorf("%s must grant the owner at least %#o, got %#o", name, required, mode)
+	}
+
+	return mode, nil
+}
+
+// fileFromMetadata converts stored metadata to its listing entry.
+func fileFromMetadata(meta service.FileMetadata) *fileservice.File {
+	return &fileservice.File{
+		Filename:          meta.Filename,
+		CreatedAt:         meta.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         meta.UpdatedAt.Format(time.RFC3339),
+		Generation:        meta.Generation,
+		SizeBytes:         meta.SizeBytes,
+		PhysicalSizeBytes: meta.PhysicalSizeBytes,
+		Sha256:            meta.SHA256,
+		ContentType:       meta.ContentType,
+	}
+}
 
-	return grpcServer.Serve(lis)
+// uploadResults maps service upload outcomes to their wire values.
+var uploadResults = map[service.UploadResult]fileservice.UploadResult{
+	service.UploadCreated:     fileservice.UploadResult_UPLOAD_RESULT_CREATED,
+	service.UploadOverwritten: fileservice.UploadResult_UPLOAD_RESULT_OVERWRITTEN,
+	service.UploadUnchanged:   fileservice.UploadResult_UPLOAD_RESULT_UNCHANGED,
 }
 
 func (s *FileServer) UploadFile(stream fileservice.FileService_UploadFileServer) error {
+	log := s.logger(stream.Context())
+
 	req, err := stream.Recv()
+	if err == io.EOF {
+		log.Error("upload closed before file info")
+		return status.Error(codes.InvalidArgument, "upload closed before file info was sent")
+	}
 	if err != nil {
-		s.log.Error("failed to receive file info", "error", err)
+		log.Error("failed to receive file info", "error", err)
 		return err
 	}
 
 	info := req.GetInfo()
 	if info == nil {
-		s.log.Error("invalid first message, expected file info")
-		return io.ErrUnexpectedEOF
+		log.Error("invalid first message, expected file info")
+		if req.GetChunk() != nil {
+			return status.Error(codes.FailedPrecondition, "chunk received before file info")
+		}
+		return status.Error(codes.InvalidArgument, "first message must carry file info")
 	}
 
 	filename := info.Filename
-	if filename == "" {
-		s.log.Error("empty filename")
-		return io.ErrUnexpectedEOF
+	if err := service.ValidateFilename(filename); err != nil {
+		log.Error("invalid filename", "error", err)
+		return err
 	}
 
 	pr, pw := io.Pipe()
 	defer pr.Close()
 
+	ctx := stream.Context()
+	if s.uploadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.uploadTimeout)
+		defer cancel()
+
+		// Recv only returns once the stream ends, so a stalled client is cut
+		// off by failing the pipe, which releases the upload slot
+		go func() {
+			<-ctx.Done()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Warn("upload timed out", "filename", filename, "timeout", s.uploadTimeout)
+				pw.CloseWithError(status.Errorf(codes.DeadlineExceeded,
+					"upload of %q did not finish within %v", filename, s.uploadTimeout))
+			}
+		}()
+	}
+
 	go func() {
 		defer pw.Close()
-		for {
+		var (
+			received   int64
+			lastReport = time.Now()
+		)
+		for n := 0; ; n++ {
 			req, err := stream.Recv()
 			if err == io.EOF {
 				break
 			}
 			if err != nil {
-				s.log.Error("failed to receive chunk", "error", err)
+				log.Error("failed to receive chunk", "error", err)
 				pw.CloseWithError(err)
 				return
 			}
 
 			chunk := req.GetChunk()
 			if chunk == nil {
-				s.log.Error("invalid message, expected chunk")
-				pw.CloseWithError(io.ErrUnexpectedEOF)
+				log.Error("invalid message, expected chunk")
+				pw.CloseWithError(status.Error(codes.InvalidArgument, "file info sent more than once"))
+				return
+			}
+
+			if req.ChunkCrc32 != nil && crc32.ChecksumIEEE(chunk) != *req.ChunkCrc32 {
+				log.Error("chunk checksum mismatch", "filename", filename, "chunk", n)
+				pw.CloseWithError(status.Errorf(codes.DataLoss, "checksum mismatch in chunk %d", n))
 				return
 			}
 
 			if _, err := pw.Write(chunk); err != nil {
-				s.log.Error("failed to write chunk", "error", err)
+				log.Error("failed to write chunk", "error", err)
 				pw.CloseWithError(err)
 				return
 			}
+
+			received += int64(len(chunk))
+			if time.Since(lastReport) >= uploadProgressInterval {
+				log.Info("upload in progress", "filename", filename, "bytes", received)
+				lastReport = time.Now()
+			}
 		}
 	}()
 
-	if err := s.fileService.UploadFile(stream.Context(), filename, pr); err != nil {
+	meta, result, err := s.fileService.UploadFile(ctx, service.UploadInfo{
+		Filename:          filename,
+		ContentType:       info.ContentType,
+		SHA256:            info.Sha256,
+		IfGenerationMatch: info.IfGenerationMatch,
+		Resumable:         info.Resumable,
+		Offset:            info.Offset,
+		Overwrite:         info.Overwrite,
+		Size:              info.Size,
+	}, pr)
+	if err != nil {
 		return err
 	}
 
 	if err := stream.SendAndClose(&fileservice.UploadResponse{
-		Filename: filename,
+		Filename:   filename,
+		Sha256:     meta.SHA256,
+		Generation: meta.Generation,
+		Result:     uploadResults[result],
 	}); err != nil {
-		s.log.Error("failed to send response", "error", err)
+		log.Error("failed to send response", "error", err)
 		return err
 	}
 
-	s.log.Info("file uploaded successfully", "filename", filename)
+	s.metrics.transferred("upload", meta.SizeBytes)
+	log.Info("file uploaded successfully",
+		"filename", filename, "bytes", meta.SizeBytes, "result", uploadResults[result])
 	return nil
 }
 
+func (s *FileServer) GetUploadOffset(
+	ctx context.Context,
+	req *fileservice.UploadOffsetRequest,
+) (*fileservice.UploadOffsetResponse, error) {
+
+	offset, err := s.fileService.UploadOffset(ctx, req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileservice.UploadOffsetResponse{Offset: offset}, nil
+}
+
 func (s *FileServer) DownloadFile(
 	req *fileservice.DownloadRequest,
 	stream fileservice.FileService_DownloadFileServer,
 ) error {
 
 	filename := req.Filename
-	if filename == "" {
-		s.log.Error("empty filename")
-		return io.ErrUnexpectedEOF
+
+	file, err := s.fileService.DownloadRange(stream.Context(), filename, req.Offset, req.Length)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+
+	return s.sendDownload(stream, file, filename, req.Compress, nil)
+}
+
+func (s *FileServer) DownloadByChecksum(
+	req *fileservice.DownloadByChecksumRequest,
+	stream fileservice.FileService_DownloadByChecksumServer,
+) error {
 
-	file, err := s.fileService.DownloadFile(stream.Context(), filename)
+	file, meta, err := s.fileService.DownloadByChecksum(stream.Context(), req.Sha256)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	buf := make([]byte, 1024*32) // 32KB chunks
+	return s.sendDownload(stream, file, meta.Filename, req.Compress, &fileservice.DownloadResponse{
+		Filename: meta.Filename,
+	})
+}
+
+// sendDownload sends file in chunks, gzip compressed if compress is set.
+// Fields set in first are sent along with the first chunk, or on their own
+// if the file is empty.
+func (s *FileServer) sendDownload(
+	stream grpc.ServerStreamingServer[fileservice.DownloadResponse],
+	file *service.Download,
+	filename string,
+	compress bool,
+	first *fileservice.DownloadResponse,
+) error {
+
+	log := s.logger(stream.Context())
+
+	var src io.Reader = file
+	size := file.Size
+	if compress {
+		zr := gzipReader(file)
+		defer zr.Close()
+		src = zr
+		size = -1 // the compressed size is not known up front
+	}
+
+	var sent int64
+	buf := s.buffers.get(size)
+	defer s.buffers.put(buf)
 	for {
-		n, err := file.Read(buf)
+		// fill whole chunks, the compressor hands out small pieces
+		n, err := io.ReadFull(src, buf)
+		if err == io.ErrUnexpectedEOF {
+			err = nil // last, short chunk
+		}
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			s.log.Error("failed to read file", "error", err, "filename", filename)
+			log.Error("failed to read file", "error", err, "filename", filename)
 			return err
 		}
 
-		if err := stream.Send(&fileservice.DownloadResponse{
-			Chunk: buf[:n],
-		}); err != nil {
-			s.log.Error("failed to send chunk", "error", err, "filename", filename)
+		resp := &fileservice.DownloadResponse{}
+		if first != nil {
+			resp, first = first, nil
+		}
+		crc := crc32.ChecksumIEEE(buf[:n])
+		resp.Chunk = buf[:n]
+		resp.ChunkCrc32 = &crc
+		resp.Compressed = compress
+		if err := stream.Send(resp); err != nil {
+			// a failed Send ends the stream, so all that is left is telling
+			// a client that went away from a broken transport
+			if ctx := stream.Context(); ctx.Err() != nil {
+				log.Warn("client went away during download",
+					"filename", filename, "sent", sent, "reason", context.Cause(ctx))
+			} else {
+				log.Error("failed to send chunk", "error", err, "filename", filename, "sent", sent)
+			}
+			return err
+		}
+		sent += int64(n)
+	}
+
+	if first != nil {
+		if err := stream.Send(first); err != nil {
+			log.Error("failed to send response", "error", err, "filename", filename)
 			return err
 		}
 	}
 
-	s.log.Info("file downloaded successfully", "filename", filename)
+	s.metrics.transferred("download", sent)
+	log.Info("file downloaded successfully", "filename", filename)
 
 	return nil
 }
 
+func (s *FileServer) FindByChecksum(
+	ctx context.Context,
+	req *fileservice.FindByChecksumRequest,
+) (*fileservice.FindByChecksumResponse, error) {
+
+	files, err := s.fileService.FilesByChecksum(req.Sha256)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &fileservice.FindByChecksumResponse{}
+	for _, file := range files {
+		response.Files = append(response.Files, fileFromMetadata(file))
+	}
+
+	s.logger(ctx).Info("found files by checksum", "sha256", req.Sha256, "count", len(files))
+	return response, nil
+}
+
 func (s *FileServer) ListFiles(
 	ctx context.Context,
 	req *fileservice.ListRequest,
 ) (*fileservice.ListResponse, error) {
 
-	files, err := s.fileService.ListFiles(ctx)
+	startAfter, err := decodePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, err := s.fileService.ListFiles(ctx, req.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &fileservice.ListResponse{TotalFiles: uint64(len(listed))}
+	for _, file := range listed {
+		response.TotalBytes += uint64(file.SizeBytes)
+	}
+
+	files := service.FilesAfter(listed, startAfter)
+
+	pageSize := int(req.PageSize)
+	if pageSize <= 0 || pageSize > maxListPageSize {
+		pageSize = maxListPageSize
+	}
+	if len(files) > pageSize {
+		files = files[:pageSize]
+		response.NextPageToken = encodePageToken(files[len(files)-1].Filename)
+	}
+
+	for _, file := range files {
+		response.Files = append(response.Files, fileFromMetadata(file))
+	}
+
+	// Session reuses this handler on a stream that is already under way, so
+	// only a plain ListFiles call can still pick its compressor
+	compressed := false
+	if method, _ := grpc.Method(ctx); method == fileservice.FileService_ListFiles_FullMethodName &&
+		len(files) >= compressListMin {
+		compressed = compressResponse(ctx)
+	}
+
+	s.logger(ctx).Info("listed files", "count", len(files), "pattern", req.Pattern, "compressed", compressed)
+	return response, nil
+}
+
+func (s *FileServer) ListFilesStream(
+	req *fileservice.ListStreamRequest,
+	stream fileservice.FileService_ListFilesStreamServer,
+) error {
+
+	count := 0
+	err := s.fileService.WalkFiles(stream.Context(), req.StartAfter, req.Pattern, func(file service.FileMetadata) error {
+		if err := stream.Send(fileFromMetadata(file)); err != nil {
+			s.logger(stream.Context()).Error("failed to send file", "error", err, "filename", file.Filename)
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logger(stream.Context()).Info("streamed files", "count", count, "start_after", req.StartAfter, "pattern", req.Pattern)
+	return nil
+}
+
+func (s *FileServer) BatchStat(
+	ctx context.Context,
+	req *fileservice.BatchStatRequest,
+) (*fileservice.BatchStatResponse, error) {
+
+	results, err := s.fileService.StatFiles(ctx, req.Filenames, req.Pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &fileservice.BatchStatResponse{}
+	for _, result := range results {
+		stat := &fileservice.FileStat{Filename: result.Filename}
+		if result.Err != nil {
+			stat.Error = status.Convert(result.Err).Message()
+		} else {
+			stat.File = fileFromMetadata(result.Metadata)
+		}
+		response.Files = append(response.Files, stat)
+	}
+
+	s.logger(ctx).Info("stat files", "count", len(results))
+	return response, nil
+}
+
+func (s *FileServer) GetFileInfo(
+	ctx context.Context,
+	req *fileservice.GetFileInfoRequest,
+) (*fileservice.File, error) {
+
+	meta, err := s.fileService.GetFileInfo(ctx, req.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileFromMetadata(meta), nil
+}
+
+func (s *FileServer) RenameFile(
+	ctx context.Context,
+	req *fileservice.RenameRequest,
+) (*fileservice.File, error) {
+
+	meta, err := s.fileService.RenameFile(ctx, req.From, req.To, req.IfGenerationMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileFromMetadata(meta), nil
+}
+
+func (s *FileServer) CopyFile(
+	ctx context.Context,
+	req *fileservice.CopyRequest,
+) (*fileservice.File, error) {
+
+	meta, err := s.fileService.CopyFile(ctx, req.Source, req.Destination, req.Overwrite, req.IfGenerationMatch)
+	if err != nil {
+		return nil, err
+	}
+
+	return fileFromMetadata(meta), nil
+}
+
+func (s *FileServer) ListStats(
+	ctx context.Context,
+	req *fileservice.ListStatsRequest,
+) (*fileservice.ListStatsResponse, error) {
+
+	stats, err := s.fileService.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &fileservice.ListStatsResponse{
+		TotalFiles: uint64(stats.Files),
+		TotalBytes: uint64(stats.Bytes),
+	}
+	for _, es := range stats.ByExtension {
+		response.Extensions = append(response.Extensions, &fileservice.ExtensionStats{
+			Extension: es.Extension,
+			Files:     uint64(es.Files),
+			Bytes:     uint64(es.Bytes),
+		})
+	}
+	if stats.Files > 0 {
+		response.Largest = fileFromMetadata(stats.Largest)
+		response.Oldest = fileFromMetadata(stats.Oldest)
+	}
+
+	s.logger(ctx).Info("computed store stats", "files", stats.Files)
+	return response, nil
+}
+
+func (s *FileServer) StreamStats(
+	req *fileservice.StreamStatsRequest,
+	stream fileservice.FileService_StreamStatsServer,
+) error {
+
+	interval := time.Duration(req.IntervalMs) * time.Millisecond
+	if interval == 0 {
+		interval = defaultStatsInterval
+	}
+	interval = max(interval, minStatsInterval)
+
+	log := s.logger(stream.Context())
+	log.Info("streaming stats", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		usage := s.fileService.Usage()
+		if err := stream.Send(&fileservice.StatsSnapshot{
+			Time:            time.Now().Format(time.RFC3339),
+			ActiveUploads:   usage.Uploads,
+			ActiveDownloads: usage.Downloads,
+			ActiveLists:     usage.Lists,
+			TotalFiles:      uint64(usage.Files),
+			TotalBytes:      uint64(max(usage.Bytes, 0)),
+		}); err != nil {
+			log.Warn("failed to send stats", "error", err)
+			return err
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return nil
+		case <-s.stopping:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (s *FileServer) ListQuarantine(
+	ctx context.Context,
+	req *fileservice.ListQuarantineRequest,
+) (*fileservice.ListQuarantineResponse, error) {
+
+	files, err := s.fileService.ListQuarantine(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	response := &fileservice.ListResponse{}
+	response := &fileservice.ListQuarantineResponse{}
 	for _, file := range files {
-		response.Files = append(response.Files, &fileservice.File{
-			Filename:  file.Filename,
-			CreatedAt: file.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: file.UpdatedAt.Format(time.RFC3339),
+		response.Files = append(response.Files, &fileservice.QuarantinedFile{
+			Filename:      file.Filename,
+			Reason:        file.QuarantineReason,
+			QuarantinedAt: file.UpdatedAt.Format(time.RFC3339),
 		})
 	}
 
-	s.log.Info("listed files", "count", len(files))
+	s.logger(ctx).Info("listed quarantined files", "count", len(files))
 	return response, nil
 }
+
+func (s *FileServer) GetPreview(
+	ctx context.Context,
+	req *fileservice.PreviewRequest,
+) (*fileservice.PreviewResponse, error) {
+
+	filename := req.Filename
+
+	preview, err := s.fileService.GetPreview(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger(ctx).Info("generated preview", "filename", filename)
+	return &fileservice.PreviewResponse{
+		Image:  preview.Data,
+		Width:  uint32(preview.Width),
+		Height: uint32(preview.Height),
+	}, nil
+}
+
+func (s *FileServer) GetHexdump(
+	ctx context.Context,
+	req *fileservice.HexdumpRequest,
+) (*fileservice.HexdumpResponse, error) {
+
+	filename := req.Filename
+
+	dump, err := s.fileService.GetHexdump(ctx, filename, int(req.Length))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileservice.HexdumpResponse{
+		Hexdump:   dump.Dump,
+		Length:    uint32(dump.Length),
+		Truncated: dump.Truncated,
+	}, nil
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"protos/gen/fileservice"
+	"server/internal/service"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer starts a file server on a file service storing its files
+// in a new temporary directory, allowing limit uploads, downloads and
+// listings at a time.
+func newTestServer(t testing.TB, limit int64, uploadTimeout time.Duration) *FileServer {
+	t.Helper()
+
+	log := slog.New(slog.DiscardHandler)
+	fs, err := service.New(service.Options{
+		UploadDir:     t.TempDir(),
+		UploadLimit:   limit,
+		DownloadLimit: limit,
+		ListLimit:     limit,
+	}, log)
+	if err != nil {
+		t.Fatalf("service.New: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+
+	return NewFileServer(fs, nil, newMaintenance(health.NewServer()), uploadTimeout, defaultChunkSize, log)
+}
+
+// uploadStream is an upload stream whose client sends reqs and then closes
+// its side.
+type uploadStream struct {
+	grpc.ServerStream
+	reqs []*fileservice.UploadRequest
+	resp *fileservice.UploadResponse
+}
+
+func (s *uploadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *uploadStream) Recv() (*fileservice.UploadRequest, error) {
+	if len(s.reqs) == 0 {
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *uploadStream) SendAndClose(resp *fileservice.UploadResponse) error {
+	s.resp = resp
+	return nil
+}
+
+func TestUploadFileStatusCodes(t *testing.T) {
+	s := newTestServer(t, 1, 0)
+
+	info := func(filename string) *fileservice.UploadRequest {
+		return &fileservice.UploadRequest{Data: &fileservice.UploadRequest_Info{
+			Info: &fileservice.FileInfo{Filename: filename},
+		}}
+	}
+	chunk := &fileservice.UploadRequest{Data: &fileservice.UploadRequest_Chunk{Chunk: []byte("content")}}
+	badCrc := uint32(0)
+	corrupt := &fileservice.UploadRequest{
+		Data:       &fileservice.UploadRequest_Chunk{Chunk: []byte("content")},
+		ChunkCrc32: &badCrc,
+	}
+
+	tests := []struct {
+		name string
+		reqs []*fileservice.UploadRequest
+		want codes.Code
+	}{
+		{"no messages", nil, codes.InvalidArgument},
+		{"empty first message", []*fileservice.UploadRequest{{}}, codes.InvalidArgument},
+		{"chunk before info", []*fileservice.UploadRequest{chunk, info("a.txt")}, codes.FailedPrecondition},
+		{"empty filename", []*fileservice.UploadRequest{info(""), chunk}, codes.InvalidArgument},
+		{"invalid filename", []*fileservice.UploadRequest{info("../a.txt"), chunk}, codes.InvalidArgument},
+		{"info sent twice", []*fileservice.UploadRequest{info("a.txt"), info("a.txt"), chunk}, codes.InvalidArgument},
+		{"corrupt chunk", []*fileservice.UploadRequest{info("a.txt"), corrupt}, codes.DataLoss},
+		{"valid upload", []*fileservice.UploadRequest{info("a.txt"), chunk}, codes.OK},
+	}
+	for _, tt := range tests {
+		stream := &uploadStream{reqs: tt.reqs}
+		if err := s.UploadFile(stream); status.Code(err) != tt.want {
+			t.Errorf("%s: UploadFile = %v, want %v", tt.name, err, tt.want)
+		}
+		if tt.want == codes.OK && stream.resp.GetFilename() != "a.txt" {
+			t.Errorf("%s: response = %v, want one for a.txt", tt.name, stream.resp)
+		}
+	}
+}
+
+func TestEmptyFilenameStatusCodes(t *testing.T) {
+	s := newTestServer(t, 1, 0)
+	ctx := context.Background()
+
+	if _, err := s.GetPreview(ctx, &fileservice.PreviewRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetPreview = %v, want InvalidArgument", err)
+	}
+	if _, err := s.GetHexdump(ctx, &fileservice.HexdumpRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetHexdump = %v, want InvalidArgument", err)
+	}
+}
+
+// downloadStream is a download stream writing the chunks it is sent to w.
+type downloadStream struct {
+	grpc.ServerStream
+	w io.Writer
+}
+
+func (s *downloadStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *downloadStream) Send(resp *fileservice.DownloadResponse) error {
+	_, err := s.w.Write(resp.Chunk)
+	return err
+}
+
+// storeFile uploads content to the file service of s as filename.
+func storeFile(t testing.TB, s *FileServer, filename string, content []byte) {
+	t.Helper()
+
+	info := service.UploadInfo{Filename: filename}
+	if _, _, err := s.fileService.UploadFile(context.Background(), info, bytes.NewReader(content)); err != nil {
+		t.Fatalf("UploadFile(%q): %v", filename, err)
+	}
+}
+
+// Files sized around the chunk size download intact, whether they get a
+// buffer of their own or a pooled one.
+func TestDownloadChunkBoundary(t *testing.T) {
+	s := newTestServer(t, 1, 0)
+
+	for _, size := range []int{0, 1, defaultChunkSize - 1, defaultChunkSize, defaultChunkSize + 1, 2 * defaultChunkSize} {
+		filename := fmt.Sprintf("%d.bin", size)
+		content := bytes.Repeat([]byte{byte(size)}, size)
+		storeFile(t, s, filename, content)
+
+		var got bytes.Buffer
+		if err := s.DownloadFile(&fileservice.DownloadRequest{Filename: filename}, &downloadStream{w: &got}); err != nil {
+			t.Fatalf("download of %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got.Bytes(), content) {
+			t.Errorf("download of %d bytes returned %d different bytes", size, got.Len())
+		}
+	}
+}
+
+// BenchmarkSmallDownloads runs many concurrent downloads of files below and
+// at the chunk size, reporting the memory each one takes.
+func BenchmarkSmallDownloads(b *testing.B) {
+	for _, size := range []int{1 << 10, defaultChunkSize} {
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			s := newTestServer(b, 1024, 0)
+			const files = 100
+			for i := range files {
+				storeFile(b, s, fmt.Sprintf("%d.bin", i), make([]byte, size))
+			}
+
+			b.SetParallelism(16)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				stream := &downloadStream{w: io.Discard}
+				for i := 0; pb.Next(); i++ {
+					req := &fileservice.DownloadRequest{Filename: fmt.Sprintf("%d.bin", i%files)}
+					if err := s.DownloadFile(req, stream); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"hash/crc32"
+	"io"
+	"protos/gen/fileservice"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxSessionDownload is the largest file served through a session.
+	maxSessionDownload = 1024 * 1024 // 1MB
+	// maxSessionInFlight bounds concurrently handled requests per session.
+	maxSessionInFlight = 16
+)
+
+func (s *FileServer) Session(stream fileservice.FileService_SessionServer) error {
+	ctx := stream.Context()
+
+	var (
+		sendMu   sync.Mutex
+		wg       sync.WaitGroup
+		inFlight = semaphore.NewWeighted(maxSessionInFlight)
+	)
+	defer wg.Wait()
+
+	send := func(resp *fileservice.SessionResponse) {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if err := stream.Send(resp); err != nil {
+			s.logger(stream.Context()).Error("failed to send session response", "error", err, "session_request_id", resp.RequestId)
+		}
+	}
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			s.logger(stream.Context()).Error("failed to receive session request", "error", err)
+			return err
+		}
+
+		if err := inFlight.Acquire(ctx, 1); err != nil {
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer inFlight.Release(1)
+			send(s.dispatchSession(ctx, req))
+		}()
+	}
+}
+
+// dispatchSession runs a single session request and wraps its outcome.
+func (s *FileServer) dispatchSession(
+	ctx context.Context,
+	req *fileservice.SessionRequest,
+) *fileservice.SessionResponse {
+
+	resp := &fileservice.SessionResponse{RequestId: req.RequestId}
+
+	// the session itself is in flight, its requests are new operations
+	err := s.maintenance.check()
+	if err == nil {
+		err = s.dispatchSessionOp(ctx, req, resp)
+	}
+
+	if err != nil {
+		st, _ := status.FromError(err)
+		resp.Result = &fileservice.SessionResponse_Error{
+			Error: &fileservice.SessionError{
+				Code:    int32(st.Code()),
+				Message: st.Message(),
+			},
+		}
+	}
+
+	return resp
+}
+
+// dispatchSessionOp runs the operation of a session request and stores its
+// result in resp.
+func (s *FileServer) dispatchSessionOp(
+	ctx context.Context,
+	req *fileservice.SessionRequest,
+	resp *fileservice.SessionResponse,
+) error {
+
+	var err error
+	switch op := req.Op.(type) {
+	case *fileservice.SessionRequest_List:
+		var list *fileservice.ListResponse
+		if list, err = s.ListFiles(ctx, op.List); err == nil {
+			resp.Result = &fileservice.SessionResponse_List{List: list}
+		}
+
+	case *fileservice.SessionRequest_Download:
+		var download *fileservice.DownloadResponse
+		if download, err = s.sessionDownload(ctx, op.Download); err == nil {
+			resp.Result = &fileservice.SessionResponse_Download{Download: download}
+		}
+
+	case *fileservice.SessionRequest_Stat:
+		var file *fileservice.File
+		if file, err = s.GetFileInfo(ctx, op.Stat); err == nil {
+			resp.Result = &fileservice.SessionResponse_Stat{Stat: file}
+		}
+
+	default:
+		err = status.Error(codes.InvalidArgument, "unknown session operation")
+	}
+
+	return err
+}
+
+// sessionDownload reads a small file, or the requested range of one, into a
+// single response. The response is compressed along with the rest of the
+// session, so compression cannot be asked for per download.
+func (s *FileServer) sessionDownload(
+	ctx context.Context,
+	req *fileservice.DownloadRequest,
+) (*fileservice.DownloadResponse, error) {
+
+	filename := req.Filename
+
+	if req.Compress {
+		return nil, status.Error(codes.InvalidArgument,
+			"compressed downloads are not available in a session, use DownloadFile")
+	}
+
+	file, err := s.fileService.DownloadRange(ctx, filename, req.Offset, req.Length)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSessionDownload+1))
+	if err != nil {
+		s.logger(ctx).Error("failed to read file", "error", err, "filename", filename)
+		return nil, err
+	}
+	if len(data) > maxSessionDownload {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"download of %q is too large for a session, use DownloadFile", filename)
+	}
+
+	crc := crc32.ChecksumIEEE(data)
+
+	s.logger(ctx).Info("file downloaded successfully", "filename", filename)
+	return &fileservice.DownloadResponse{Chunk: data, ChunkCrc32: &crc}, nil
+}
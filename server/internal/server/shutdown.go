@@ -0,0 +1,59 @@
+package server
+
+import (
+	"log/slog"
+	"server/internal/service"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// shutdownReportInterval is how often a graceful stop logs the operations
+// it is still waiting for.
+const shutdownReportInterval = 5 * time.Second
+
+// stopGracefully stops the server, letting in-flight calls finish and
+// periodically logging how many are left. Once timeout passes the remaining
+// calls are cancelled. A zero timeout waits indefinitely.
+func stopGracefully(
+	grpcServer *grpc.Server,
+	fileService *service.FileService,
+	timeout time.Duration,
+	log *slog.Logger,
+) {
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	ticker := time.NewTicker(shutdownReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			log.Info("server stopped")
+			return
+		case <-ticker.C:
+			n := fileService.InFlight()
+			log.Info("waiting for in-flight operations",
+				"uploads", n.Uploads, "downloads", n.Downloads, "lists", n.Lists)
+		case <-deadline:
+			n := fileService.InFlight()
+			log.Warn("shutdown timeout reached, cancelling in-flight operations",
+				"timeout", timeout, "uploads", n.Uploads, "downloads", n.Downloads, "lists", n.Lists)
+			grpcServer.Stop()
+			<-stopped
+			return
+		}
+	}
+}
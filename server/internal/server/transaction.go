@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"protos/gen/fileservice"
+	"server/internal/service"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *FileServer) UploadTransaction(stream fileservice.FileService_UploadTransactionServer) error {
+	log := s.logger(stream.Context())
+
+	ctx := stream.Context()
+	if s.uploadTimeout > 0 {
+		// the transaction holds an upload slot throughout, so it gets no
+		// longer than a single upload
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.uploadTimeout)
+		defer cancel()
+	}
+
+	tx, err := s.fileService.BeginTransaction(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Abort()
+
+	var (
+		pw       *io.PipeWriter
+		filename string
+		staged   chan error
+	)
+
+	// stop a file still being staged before the transaction is discarded
+	defer func() {
+		if pw != nil {
+			pw.CloseWithError(io.ErrUnexpectedEOF)
+			<-staged
+		}
+	}()
+
+	// finishFile waits for the file being staged and acknowledges it.
+	finishFile := func() error {
+		if pw == nil {
+			return nil
+		}
+		pw.Close()
+		pw = nil
+
+		if err := <-staged; err != nil {
+			return err
+		}
+
+		return stream.Send(&fileservice.TransactionResponse{
+			Event: &fileservice.TransactionResponse_Staged{
+				Staged: &fileservice.UploadResponse{Filename: filename},
+			},
+		})
+	}
+
+	// Recv only returns once the client sends or the stream ends, so it runs
+	// apart from the loop, which can then give up on a stalled client and
+	// free the upload slot
+	reqs := make(chan *fileservice.TransactionRequest)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var req *fileservice.TransactionRequest
+		select {
+		case req = <-reqs:
+		case err := <-recvErr:
+			if err == io.EOF {
+				log.Info("transaction closed without commit, aborting")
+				return status.Error(codes.Aborted, "transaction closed without commit")
+			}
+			log.Error("failed to receive transaction request", "error", err)
+			return err
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				log.Warn("transaction timed out", "timeout", s.uploadTimeout)
+				return status.Errorf(codes.DeadlineExceeded,
+					"transaction did not finish within %v", s.uploadTimeout)
+			}
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		switch op := req.Op.(type) {
+		case *fileservice.TransactionRequest_Begin:
+			if err := finishFile(); err != nil {
+				return err
+			}
+
+			filename = op.Begin.Filename
+			if err := service.ValidateFilename(filename); err != nil {
+				log.Error("invalid filename", "error", err)
+				return err
+			}
+
+			var pr *io.PipeReader
+			pr, pw = io.Pipe()
+			staged = make(chan error, 1)
+
+			info := service.UploadInfo{
+				Filename:          filename,
+				ContentType:       op.Begin.ContentType,
+				SHA256:            op.Begin.Sha256,
+				IfGenerationMatch: op.Begin.IfGenerationMatch,
+				Overwrite:         op.Begin.Overwrite,
+				Size:              op.Begin.Size,
+			}
+			go func() {
+				err := tx.Stage(ctx, info, pr)
+				// unblock the receive loop if staging stopped early
+				pr.CloseWithError(io.ErrClosedPipe)
+				staged <- err
+			}()
+
+		case *fileservice.TransactionRequest_Chunk:
+			if pw == nil {
+				return status.Error(codes.FailedPrecondition, "chunk received before file info")
+			}
+			if _, err := pw.Write(op.Chunk); err != nil {
+				// staging stopped early, report its error
+				pw = nil
+				if err := <-staged; err != nil {
+					return err
+				}
+				return status.Error(codes.Internal, "failed to stage file")
+			}
+
+		case *fileservice.TransactionRequest_Commit:
+			if err := finishFile(); err != nil {
+				return err
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+
+			log.Info("transaction committed", "files", len(tx.Filenames()))
+			return stream.Send(&fileservice.TransactionResponse{
+				Event: &fileservice.TransactionResponse_Result{
+					Result: &fileservice.TransactionResult{
+						Committed: true,
+						Filenames: tx.Filenames(),
+					},
+				},
+			})
+
+		case *fileservice.TransactionRequest_Abort:
+			log.Info("transaction aborted")
+			return stream.Send(&fileservice.TransactionResponse{
+				Event: &fileservice.TransactionResponse_Result{
+					Result: &fileservice.TransactionResult{Committed: false},
+				},
+			})
+
+		default:
+			return status.Error(codes.InvalidArgument, "unknown transaction operation")
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"protos/gen/fileservice"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// transactionStream is a transaction stream whose client sends the
+// requests written to recv and then goes silent.
+type transactionStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	recv chan *fileservice.TransactionRequest
+}
+
+func (s *transactionStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *transactionStream) Recv() (*fileservice.TransactionRequest, error) {
+	select {
+	case req := <-s.recv:
+		return req, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *transactionStream) Send(*fileservice.TransactionResponse) error {
+	return nil
+}
+
+func TestUploadTransactionTimeout(t *testing.T) {
+	s := newTestServer(t, 1, 50*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &transactionStream{ctx: ctx, recv: make(chan *fileservice.TransactionRequest, 2)}
+	stream.recv <- &fileservice.TransactionRequest{Op: &fileservice.TransactionRequest_Begin{
+		Begin: &fileservice.FileInfo{Filename: "a.txt"},
+	}}
+	stream.recv <- &fileservice.TransactionRequest{Op: &fileservice.TransactionRequest_Chunk{
+		Chunk: []byte("partial content"),
+	}}
+
+	done := make(chan error)
+	go func() { done <- s.UploadTransaction(stream) }()
+
+	select {
+	case err := <-done:
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Errorf("stalled transaction: got %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled transaction was not cut off")
+	}
+
+	if n := s.fileService.InFlight().Uploads; n != 0 {
+		t.Errorf("%d upload slots held after the transaction timed out, want 0", n)
+	}
+}
@@ -0,0 +1,80 @@
+// Package servertest runs a file server in process for end-to-end tests and
+// benchmarks, connected to its client over an in-memory listener instead of
+// a socket.
+package servertest
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"protos/gen/fileservice"
+	"server/internal/server"
+	"server/internal/service"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	// bufferSize is the size of the in-memory connection buffer.
+	bufferSize = 1 << 20
+
+	// chunkSize matches the server's default download chunk size.
+	chunkSize = 32 * 1024
+
+	// defaultLimit is used for each concurrency limit left unset in the
+	// options.
+	defaultLimit = 16
+)
+
+// New starts a file server with the given options and returns a client
+// connected to it. Files are stored in a new temporary directory unless
+// opts.UploadDir is set. The server and the connection are shut down when
+// tb ends.
+func New(tb testing.TB, opts service.Options) fileservice.FileServiceClient {
+	tb.Helper()
+
+	if opts.UploadDir == "" {
+		opts.UploadDir = tb.TempDir()
+	}
+	for _, limit := range []*int64{&opts.UploadLimit, &opts.DownloadLimit, &opts.ListLimit} {
+		if *limit <= 0 {
+			*limit = defaultLimit
+		}
+	}
+
+	log := slog.New(slog.DiscardHandler)
+	fs, err := service.New(opts, log)
+	if err != nil {
+		tb.Fatalf("service.New: %v", err)
+	}
+
+	lis := bufconn.Listen(bufferSize)
+	grpcServer := grpc.NewServer()
+	fileservice.RegisterFileServiceServer(grpcServer, server.NewFileServer(fs, nil, nil, 0, chunkSize, log))
+	go grpcServer.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		grpcServer.Stop()
+		fs.Close()
+		tb.Fatalf("grpc.NewClient: %v", err)
+	}
+
+	// stop in reverse order, the service flushes its metadata once no
+	// call is running
+	tb.Cleanup(func() {
+		conn.Close()
+		grpcServer.Stop()
+		fs.Close()
+	})
+
+	return fileservice.NewFileServiceClient(conn)
+}
@@ -0,0 +1,175 @@
+package servertest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"protos/gen/fileservice"
+	"server/internal/service"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func upload(
+	ctx context.Context,
+	client fileservice.FileServiceClient,
+	info *fileservice.FileInfo,
+	content []byte,
+) (*fileservice.UploadResponse, error) {
+
+	stream, err := client.UploadFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&fileservice.UploadRequest{Data: &fileservice.UploadRequest_Info{Info: info}}); err != nil {
+		return nil, err
+	}
+	for len(content) > 0 {
+		n := min(len(content), chunkSize)
+		if err := stream.Send(&fileservice.UploadRequest{Data: &fileservice.UploadRequest_Chunk{Chunk: content[:n]}}); err != nil {
+			break // the server ended the upload, its status says why
+		}
+		content = content[n:]
+	}
+	return stream.CloseAndRecv()
+}
+
+func download(ctx context.Context, client fileservice.FileServiceClient, filename string) ([]byte, error) {
+	stream, err := client.DownloadFile(ctx, &fileservice.DownloadRequest{Filename: filename})
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, resp.Chunk...)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	client := New(t, service.Options{})
+	ctx := context.Background()
+
+	files := map[string][]byte{
+		"empty.txt":     {},
+		"small.txt":     []byte("hello, world"),
+		"dir/large.bin": make([]byte, 3*chunkSize+100),
+		"dir/chunk.bin": make([]byte, chunkSize),
+	}
+	rand.Read(files["dir/large.bin"])
+	rand.Read(files["dir/chunk.bin"])
+
+	for filename, content := range files {
+		resp, err := upload(ctx, client, &fileservice.FileInfo{Filename: filename}, content)
+		if err != nil {
+			t.Fatalf("upload %q: %v", filename, err)
+		}
+		sum := sha256.Sum256(content)
+		if resp.Sha256 != hex.EncodeToString(sum[:]) || resp.Generation != 1 {
+			t.Errorf("upload %q: sha256 %s, generation %d; want %x, 1", filename, resp.Sha256, resp.Generation, sum)
+		}
+	}
+
+	list, err := client.ListFiles(ctx, &fileservice.ListRequest{})
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(list.Files) != len(files) {
+		t.Errorf("ListFiles returned %d files, want %d", len(list.Files), len(files))
+	}
+	for _, file := range list.Files {
+		content, ok := files[file.Filename]
+		if !ok {
+			t.Errorf("ListFiles returned unknown file %q", file.Filename)
+			continue
+		}
+		if file.SizeBytes != int64(len(content)) {
+			t.Errorf("%q: listed size %d, want %d", file.Filename, file.SizeBytes, len(content))
+		}
+	}
+
+	for filename, content := range files {
+		got, err := download(ctx, client, filename)
+		if err != nil {
+			t.Fatalf("download %q: %v", filename, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("download %q: got %d bytes differing from the upload", filename, len(got))
+		}
+	}
+
+	// without a delete call, a rename is how a name goes away
+	if _, err := client.RenameFile(ctx, &fileservice.RenameRequest{From: "small.txt", To: "moved.txt"}); err != nil {
+		t.Fatalf("RenameFile: %v", err)
+	}
+	if _, err := download(ctx, client, "small.txt"); err == nil {
+		t.Error("download of the old name succeeded")
+	}
+	info, err := client.GetFileInfo(ctx, &fileservice.GetFileInfoRequest{Filename: "small.txt"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetFileInfo of the old name: %v, %v; want NotFound", info, err)
+	}
+	if got, err := download(ctx, client, "moved.txt"); err != nil || !bytes.Equal(got, files["small.txt"]) {
+		t.Errorf("download of the new name: %q, %v; want the original content", got, err)
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	client := New(t, service.Options{})
+	ctx := context.Background()
+
+	if _, err := upload(ctx, client, &fileservice.FileInfo{Filename: "a.txt"}, []byte("one")); err != nil {
+		t.Fatalf("first upload: %v", err)
+	}
+	if _, err := upload(ctx, client, &fileservice.FileInfo{Filename: "a.txt"}, []byte("two")); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("second upload without overwrite: got %v, want AlreadyExists", err)
+	}
+
+	resp, err := upload(ctx, client, &fileservice.FileInfo{Filename: "a.txt", Overwrite: true}, []byte("two"))
+	if err != nil {
+		t.Fatalf("overwrite: %v", err)
+	}
+	if resp.Generation != 2 || resp.Result != fileservice.UploadResult_UPLOAD_RESULT_OVERWRITTEN {
+		t.Errorf("overwrite: generation %d, result %v; want 2, OVERWRITTEN", resp.Generation, resp.Result)
+	}
+	if got, err := download(ctx, client, "a.txt"); err != nil || string(got) != "two" {
+		t.Errorf("download: %q, %v; want \"two\"", got, err)
+	}
+}
+
+// BenchmarkRoundTrip uploads and downloads a file of each size through the
+// whole gRPC stack.
+func BenchmarkRoundTrip(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 20, 16 << 20} {
+		b.Run(fmt.Sprintf("%dKiB", size>>10), func(b *testing.B) {
+			client := New(b, service.Options{})
+			ctx := context.Background()
+			content := make([]byte, size)
+			rand.Read(content)
+			info := &fileservice.FileInfo{Filename: "bench.bin", Overwrite: true}
+
+			b.SetBytes(2 * int64(size))
+			for b.Loop() {
+				if _, err := upload(ctx, client, info, content); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := download(ctx, client, "bench.bin"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// backfillConcurrency bounds how many files are sniffed at once while
+// backfilling content types.
+const backfillConcurrency = 8
+
+// backfillContentTypes sniffs and records the content type of every file
+// that has none, e.g. because it was uploaded before content types were
+// recorded or copied into the upload directory by hand. It reports whether
+// any metadata changed.
+func (fs *FileService) backfillContentTypes() bool {
+	var (
+		g       errgroup.Group
+		updated atomic.Int64
+	)
+	g.SetLimit(backfillConcurrency)
+
+	for _, meta := range fs.metadata.all() {
+		if meta.ContentType != "" {
+			continue
+		}
+		g.Go(func() error {
+			contentType, err := fs.sniffContentType(meta.Filename)
+			if err != nil {
+				fs.log.Warn("failed to detect content type", "error", err, "filename", meta.Filename)
+				return nil
+			}
+
+			key := fs.metadataKey(meta.Filename)
+			unlock := fs.metadata.lock(key)
+			defer unlock()
+			if current, ok := fs.metadata.get(key); ok && current.Filename == meta.Filename {
+				current.ContentType = contentType
+				fs.metadata.put(key, current)
+				updated.Add(1)
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	if n := updated.Load(); n > 0 {
+		fs.log.Info("backfilled content types", "files", n)
+		return true
+	}
+	return false
+}
+
+// sniffContentType detects the content type of a stored file from its first
+// sniffLen bytes, the same way uploads are sniffed.
+func (fs *FileService) sniffContentType(filename string) (string, error) {
+	head := make([]byte, sniffLen)
+	var n int
+	err := fs.readFile(filename, func(r io.Reader) (err error) {
+		n, err = io.ReadFull(r, head)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
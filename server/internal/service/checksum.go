@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FilesByChecksum returns the listed files whose content has the given hex
+// encoded SHA-256, sorted by name. Files found on disk at startup without a
+// snapshot record have no known checksum and are never returned.
+func (fs *FileService) FilesByChecksum(sum string) ([]FileMetadata, error) {
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid SHA-256 %q", sum)
+	}
+
+	var files []FileMetadata
+	for _, key := range fs.metadata.bySum(sum) {
+		unlock := fs.metadata.rlock(key)
+		meta, ok := fs.metadata.get(key)
+		unlock()
+
+		// the record may have changed since bySum returned
+		if !ok || fs.isHidden(meta.Filename) || !strings.EqualFold(meta.SHA256, sum) {
+			continue
+		}
+		files = append(files, meta)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filename < files[j].Filename
+	})
+
+	return files, nil
+}
+
+// DownloadByChecksum opens a file whose content has the given checksum, the
+// first by name if several share it. It returns the chosen file's metadata
+// along with the download.
+func (fs *FileService) DownloadByChecksum(ctx context.Context, sum string) (*Download, FileMetadata, error) {
+	files, err := fs.FilesByChecksum(sum)
+	if err != nil {
+		return nil, FileMetadata{}, err
+	}
+	if len(files) == 0 {
+		return nil, FileMetadata{}, status.Errorf(codes.NotFound, "no file with SHA-256 %s", sum)
+	}
+
+	meta := files[0]
+	download, err := fs.DownloadFile(ctx, meta.Filename)
+	if err != nil {
+		return nil, FileMetadata{}, err
+	}
+
+	return download, meta, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cleanupTempFiles removes what a crash left behind in the upload directory.
+// Staged uploads and transactions never survive a restart, so all of them
+// go. Partial resumable uploads go once they are older than
+// PartialUploadMaxAge.
+func (fs *FileService) cleanupTempFiles() {
+	fs.removeStale(stagingDir, 0)
+	if fs.opts.PartialUploadMaxAge > 0 {
+		fs.removeStale(partialDir, fs.opts.PartialUploadMaxAge)
+	}
+}
+
+// removeStale removes the entries of dir, inside uploadDir, that were last
+// modified more than maxAge ago, or all of them if maxAge is zero.
+func (fs *FileService) removeStale(dir string, maxAge time.Duration) {
+	root := filepath.Join(fs.uploadDir, dir)
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		fs.log.Error("failed to read temp directory", "error", err, "dir", root)
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			fs.log.Error("failed to get temp file info", "error", err, "name", entry.Name())
+			continue
+		}
+
+		fp := filepath.Join(root, entry.Name())
+		modTime := info.ModTime()
+		if entry.IsDir() {
+			// partial uploads of nested filenames live in subdirectories
+			modTime = newestModTime(fp, modTime)
+		}
+
+		age := time.Since(modTime)
+		if maxAge > 0 && age <= maxAge {
+			continue
+		}
+
+		if err := os.RemoveAll(fp); err != nil {
+			fs.log.Error("failed to remove temp file", "error", err, "path", fp)
+			continue
+		}
+		fs.log.Info("removed leftover temp file", "path", fp, "age", age.Round(time.Second))
+	}
+}
+
+// newestModTime returns the latest modification time of the files under dir,
+// or since if none is later.
+func newestModTime(dir string, since time.Time) time.Time {
+	newest := since
+	filepath.WalkDir(dir, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CopyFile stores a copy of the file from under the name to without the
+// content leaving the server. The stored bytes are copied as they are, so an
+// encrypted file stays encrypted, and the copy gets the source's checksum and
+// content type with timestamps of its own. Unless overwrite is set an
+// existing destination is refused, like an upload of it would be. A set
+// ifGenerationMatch decides instead, as for an upload: the destination must
+// be at that generation, or not exist if it is 0.
+func (fs *FileService) CopyFile(
+	ctx context.Context,
+	from, to string,
+	overwrite bool,
+	ifGenerationMatch *int64,
+) (FileMetadata, error) {
+
+	for _, filename := range []string{from, to} {
+		if err := sanitizeFilename(filename); err != nil {
+			return FileMetadata{}, err
+		}
+		if isInternalFile(filename) {
+			return FileMetadata{}, status.Errorf(codes.InvalidArgument, "filename %q is reserved", filename)
+		}
+	}
+	// a copy must not get around the upload restriction
+	if err := fs.checkExtension(to); err != nil {
+		return FileMetadata{}, err
+	}
+	if fs.metadataKey(from) == fs.metadataKey(to) {
+		return FileMetadata{}, status.Errorf(codes.InvalidArgument, "cannot copy %q onto itself", from)
+	}
+
+	log := fs.logger(ctx)
+	if err := fs.uploadSem.acquire(ctx, log); err != nil {
+		return FileMetadata{}, err
+	}
+	defer fs.uploadSem.release()
+
+	src, meta, err := fs.openSource(ctx, from)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		log.Error("failed to stat file", "error", err, "filename", from)
+		return FileMetadata{}, err
+	}
+
+	if err := fs.checkFreeInodes(); err != nil {
+		return FileMetadata{}, err
+	}
+	if err := fs.checkFreeSpace(UploadInfo{Filename: to, Size: stat.Size()}); err != nil {
+		return FileMetadata{}, err
+	}
+	if err := fs.checkCaseCollision(to); err != nil {
+		return FileMetadata{}, err
+	}
+	if err := fs.checkNotDirectory(to); err != nil {
+		return FileMetadata{}, err
+	}
+
+	// write to a temp file first like an upload, so a failed copy never
+	// replaces or shows up as the destination
+	tmp, err := fs.tempPath()
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	defer os.Remove(tmp)
+
+	if err := fs.copyContent(src, tmp); err != nil {
+		log.Error("failed to copy file", "error", err, "from", from, "to", to)
+		return FileMetadata{}, err
+	}
+
+	now := time.Now()
+	meta.Filename = to
+	meta.CreatedAt = now
+	meta.UpdatedAt = now
+	meta.PhysicalSizeBytes = stat.Size()
+
+	info := UploadInfo{Filename: to, Overwrite: overwrite, IfGenerationMatch: ifGenerationMatch}
+	key := fs.metadataKey(to)
+	unlock := fs.metadata.lock(key)
+	if err := fs.checkPrecondition(info); err != nil {
+		unlock()
+		return FileMetadata{}, err
+	}
+	dst, err := fs.prepareDestination(to)
+	if err != nil {
+		unlock()
+		return FileMetadata{}, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		unlock()
+		log.Error("failed to publish file", "error", err, "filename", to)
+		return FileMetadata{}, err
+	}
+	fs.publish(&meta)
+	unlock()
+
+	fs.persistMetadata()
+
+	log.Info("file copied", "from", from, "to", to, "bytes", meta.SizeBytes)
+	return meta, nil
+}
+
+// openSource opens the stored file of filename together with its record,
+// under the lock of its metadata shard so the two match even if the file is
+// replaced while it is being copied.
+func (fs *FileService) openSource(ctx context.Context, filename string) (*os.File, FileMetadata, error) {
+	key := fs.metadataKey(filename)
+	unlock := fs.metadata.rlock(key)
+	meta, ok := fs.metadata.get(key)
+	if !ok {
+		unlock()
+		if err := fs.checkQuarantine(fs.resolveName(filename)); err != nil {
+			return nil, FileMetadata{}, err
+		}
+		return nil, FileMetadata{}, status.Errorf(codes.NotFound, "file %q not found", filename)
+	}
+
+	file, err := os.Open(filepath.Join(fs.uploadDir, meta.Filename))
+	unlock()
+	if err != nil {
+		fs.logger(ctx).Error("failed to open file", "error", err, "filename", meta.Filename)
+		return nil, FileMetadata{}, err
+	}
+	return file, meta, nil
+}
+
+// copyContent copies src as it is stored to a new file at fp.
+func (fs *FileService) copyContent(src io.Reader, fp string) error {
+	file, err := fs.createFile(fp, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
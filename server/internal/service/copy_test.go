@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCopyGenerationMatch(t *testing.T) {
+	ctx := context.Background()
+	gen := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name      string
+		existing  bool
+		overwrite bool
+		want      *int64
+		code      codes.Code
+	}{
+		{"new destination", false, false, nil, codes.OK},
+		{"existing destination", true, false, nil, codes.AlreadyExists},
+		{"overwrite", true, true, nil, codes.OK},
+		{"match", true, false, gen(1), codes.OK},
+		{"mismatch", true, true, gen(2), codes.FailedPrecondition},
+		{"must not exist", false, false, gen(0), codes.OK},
+		{"must not exist but does", true, true, gen(0), codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		fs := newTestService(t, Options{})
+		upload(t, fs, "src.txt", []byte("source"))
+		if tt.existing {
+			upload(t, fs, "dst.txt", []byte("destination"))
+		}
+
+		_, err := fs.CopyFile(ctx, "src.txt", "dst.txt", tt.overwrite, tt.want)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: CopyFile = %v, want %v", tt.name, err, tt.code)
+			continue
+		}
+
+		want := "source"
+		if err != nil {
+			want = "destination"
+			if !tt.existing {
+				continue
+			}
+		}
+		if got, err := download(fs, "dst.txt"); err != nil || string(got) != want {
+			t.Errorf("%s: destination holds %q, %v; want %q", tt.name, got, err, want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Files encrypted at rest are a header followed by sealed records:
+//
+//	header: magic (4 bytes) | nonce (16 bytes)
+//	record: ciphertext length (4 bytes, big endian) | AES-GCM ciphertext
+//
+// The per-file nonce is mixed into the master key with HKDF to get the file
+// key, and each record is sealed with its counter as GCM nonce. The additional
+// data marks the final record so truncation is detected on read.
+var encMagic = []byte("FSR1")
+
+const (
+	encNonceSize = 16
+	encChunkSize = 64 * 1024
+	encInfo      = "fileservice at-rest v1"
+	// encRecordOverhead is the length prefix plus the GCM tag of a record
+	encRecordOverhead = 4 + 16
+)
+
+// KeyProvider supplies the master key used for encryption at rest, e.g. from
+// config or an external KMS.
+type KeyProvider interface {
+	MasterKey(ctx context.Context) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider returning a fixed master key.
+type StaticKey []byte
+
+func (k StaticKey) MasterKey(context.Context) ([]byte, error) {
+	return k, nil
+}
+
+var errNoKey = status.Error(codes.FailedPrecondition, "file is encrypted but no encryption key is configured")
+
+// readEncryptionHeader returns the file nonce if r starts with an encryption
+// header. The reader is not advanced.
+func readEncryptionHeader(r *bufio.Reader) (nonce []byte, ok bool) {
+	header, err := r.Peek(len(encMagic) + encNonceSize)
+	if err != nil || !bytes.Equal(header[:len(encMagic)], encMagic) {
+		return nil, false
+	}
+	return bytes.Clone(header[len(encMagic):]), true
+}
+
+// encryptionNonce reports the nonce of a file on disk that looks encrypted.
+// It is only a guess, for files found without a record: plain content may
+// start with the header magic as well.
+func encryptionNonce(path string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer file.Close()
+
+	nonce, ok := readEncryptionHeader(bufio.NewReader(file))
+	if !ok {
+		return "", false
+	}
+	return hex.EncodeToString(nonce), true
+}
+
+// encryptedPlaintextSize returns the plaintext size of an encrypted file that
+// is size bytes on disk. Every record but the last holds a full chunk, and
+// there is always at least one record.
+func encryptedPlaintextSize(size int64) int64 {
+	body := size - int64(len(encMagic)+encNonceSize)
+	records := (body + encChunkSize + encRecordOverhead - 1) / (encChunkSize + encRecordOverhead)
+	return max(body-records*encRecordOverhead, 0)
+}
+
+// nonce returns the nonce the file is encrypted with, or nil if it is stored
+// in plain.
+func (m FileMetadata) nonce() ([]byte, error) {
+	if !m.Encrypted {
+		return nil, nil
+	}
+	nonce, err := hex.DecodeString(m.EncryptionNonce)
+	if err != nil || len(nonce) != encNonceSize {
+		return nil, errDecrypt
+	}
+	return nonce, nil
+}
+
+// plaintext returns a reader yielding the decrypted content of r, which was
+// encrypted with nonce, or r itself if nonce is nil.
+func (fs *FileService) plaintext(r io.Reader, nonce []byte) (io.Reader, error) {
+	if nonce == nil {
+		return r, nil
+	}
+	if fs.masterKey == nil {
+		return nil, errNoKey
+	}
+
+	br := bufio.NewReader(r)
+	if err := checkEncryptionHeader(br, nonce); err != nil {
+		return nil, err
+	}
+
+	aead, err := fileAEAD(fs.masterKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	br.Discard(len(encMagic) + encNonceSize)
+	return &decryptReader{r: br, aead: aead}, nil
+}
+
+// checkEncryptionHeader verifies that r starts with the header of a file
+// encrypted with nonce. The reader is not advanced.
+func checkEncryptionHeader(r *bufio.Reader, nonce []byte) error {
+	if stored, ok := readEncryptionHeader(r); !ok || !bytes.Equal(stored, nonce) {
+		return errDecrypt
+	}
+	return nil
+}
+
+// openStored opens the stored file of filename and returns the nonce it is
+// encrypted with, or nil if it is stored in plain. That is taken from the
+// file's record rather than its content, which may start with the header
+// magic without being encrypted, and the file is opened under the lock of
+// its metadata shard so the two match even if it is being replaced. A file
+// without a record, e.g. one copied into the upload directory since
+// startup, is read as it is.
+func (fs *FileService) openStored(filename string) (*os.File, []byte, error) {
+	key := fs.metadataKey(filename)
+	unlock := fs.metadata.rlock(key)
+	meta, ok := fs.metadata.get(key)
+	if !ok {
+		meta = FileMetadata{Filename: filename}
+	}
+	file, err := os.Open(filepath.Join(fs.uploadDir, meta.Filename))
+	unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err := meta.nonce()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, nonce, nil
+}
+
+// openFile opens the stored file of filename for reading its plaintext
+// content.
+func (fs *FileService) openFile(filename string) (io.ReadCloser, error) {
+	file, nonce, err := fs.openStored(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := fs.plaintext(file, nonce)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, nil
+}
+
+// openFileAt opens the stored file of filename for reading its plaintext
+// content from offset, and returns the plaintext size of the whole file.
+// Plain files are seeked to offset; encrypted ones to the record holding it,
+// which is then decrypted and skipped up to offset.
+func (fs *FileService) openFileAt(filename string, offset int64) (io.ReadCloser, int64, error) {
+	file, nonce, err := fs.openStored(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r, size, err := fs.plaintextAt(file, nonce, offset)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, file}, size, nil
+}
+
+func (fs *FileService) plaintextAt(file *os.File, nonce []byte, offset int64) (io.Reader, int64, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := stat.Size()
+	if nonce != nil {
+		size = encryptedPlaintextSize(size)
+	}
+	if offset > size {
+		return nil, size, status.Errorf(codes.OutOfRange,
+			"offset %d is past the end of the file, which has %d bytes", offset, size)
+	}
+
+	if nonce == nil {
+		_, err := file.Seek(offset, io.SeekStart)
+		return file, size, err
+	}
+	if fs.masterKey == nil {
+		return nil, size, errNoKey
+	}
+	if err := checkEncryptionHeader(bufio.NewReader(file), nonce); err != nil {
+		return nil, size, err
+	}
+	if offset == size {
+		// nothing to decrypt, and past the last record if it is full
+		return bytes.NewReader(nil), size, nil
+	}
+
+	aead, err := fileAEAD(fs.masterKey, nonce)
+	if err != nil {
+		return nil, size, err
+	}
+
+	record := offset / encChunkSize
+	pos := int64(len(encMagic)+encNonceSize) + record*(encChunkSize+encRecordOverhead)
+	if _, err := file.Seek(pos, io.SeekStart); err != nil {
+		return nil, size, err
+	}
+
+	d := &decryptReader{r: bufio.NewReader(file), aead: aead, counter: uint32(record)}
+	if _, err := io.CopyN(io.Discard, d, offset%encChunkSize); err != nil {
+		return nil, size, err
+	}
+	return d, size, nil
+}
+
+// readFile passes the plaintext content of the stored file of filename to fn.
+func (fs *FileService) readFile(filename string, fn func(io.Reader) error) error {
+	file, err := fs.openFile(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return fn(file)
+}
+
+func fileAEAD(masterKey, nonce []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, masterKey, nonce, encInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func recordNonce(counter uint32) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint32(nonce[8:], counter)
+	return nonce
+}
+
+func recordAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	nonce   []byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, masterKey []byte) (*encryptWriter, error) {
+	nonce := make([]byte, encNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	aead, err := fileAEAD(masterKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(bytes.Clone(encMagic), nonce...)); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:     w,
+		aead:  aead,
+		nonce: nonce,
+		buf:   make([]byte, 0, encChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// keep a full chunk buffered so the final record is known on Close
+		if len(e.buf) == encChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(e.buf[len(e.buf):encChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the buffered data as the final record.
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	if e.counter == ^uint32(0) {
+		return errors.New("file too large to encrypt")
+	}
+
+	ct := e.aead.Seal(nil, recordNonce(e.counter), e.buf, recordAD(final))
+	e.counter++
+	e.buf = e.buf[:0]
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(ct)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(ct)
+	return err
+}
+
+var errDecrypt = status.Error(codes.DataLoss, "failed to decrypt file: wrong key or corrupted data")
+
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return errDecrypt
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > encChunkSize+uint32(d.aead.Overhead()) {
+		return errDecrypt
+	}
+
+	ct := make([]byte, n)
+	if _, err := io.ReadFull(d.r, ct); err != nil {
+		return errDecrypt
+	}
+
+	// a record is final exactly when nothing follows it
+	_, err := d.r.Peek(1)
+	final := err == io.EOF
+
+	plain, err := d.aead.Open(nil, recordNonce(d.counter), ct, recordAD(final))
+	if err != nil {
+		return errDecrypt
+	}
+
+	d.counter++
+	d.plain = plain
+	d.done = final
+	return nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestService starts a service with opts, storing files in a new
+// temporary directory unless opts.UploadDir is set.
+func newTestService(t *testing.T, opts Options) *FileService {
+	t.Helper()
+
+	if opts.UploadDir == "" {
+		opts.UploadDir = t.TempDir()
+	}
+	opts.UploadLimit = 4
+	opts.DownloadLimit = 4
+	opts.ListLimit = 4
+	fs, err := New(opts, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { fs.Close() })
+	return fs
+}
+
+func testKey(b byte) KeyProvider {
+	return StaticKey(bytes.Repeat([]byte{b}, 32))
+}
+
+func upload(t *testing.T, fs *FileService, filename string, content []byte) FileMetadata {
+	t.Helper()
+
+	meta, _, err := fs.UploadFile(context.Background(), UploadInfo{Filename: filename}, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("UploadFile(%q): %v", filename, err)
+	}
+	return meta
+}
+
+func download(fs *FileService, filename string) ([]byte, error) {
+	d, err := fs.DownloadFile(context.Background(), filename)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	return io.ReadAll(d)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fs := newTestService(t, Options{UploadDir: dir, KeyProvider: testKey(1)})
+
+	// spans three records, the last one partial
+	content := make([]byte, 2*encChunkSize+1000)
+	rand.Read(content)
+
+	meta := upload(t, fs, "data.bin", content)
+	if !meta.Encrypted || meta.SizeBytes != int64(len(content)) {
+		t.Errorf("metadata = encrypted %v, size %d; want encrypted, size %d",
+			meta.Encrypted, meta.SizeBytes, len(content))
+	}
+
+	stored, err := os.ReadFile(filepath.Join(dir, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, content[:64]) {
+		t.Error("content is stored in plain")
+	}
+
+	got, err := download(fs, "data.bin")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content differs from the upload")
+	}
+
+	offset := int64(encChunkSize + 10)
+	d, err := fs.DownloadRange(context.Background(), "data.bin", offset, 100)
+	if err != nil {
+		t.Fatalf("DownloadRange: %v", err)
+	}
+	got, err = io.ReadAll(d)
+	d.Close()
+	if err != nil {
+		t.Fatalf("read range: %v", err)
+	}
+	if !bytes.Equal(got, content[offset:offset+100]) {
+		t.Error("downloaded range differs from the upload")
+	}
+}
+
+func TestEncryptionWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	fs := newTestService(t, Options{UploadDir: dir, KeyProvider: testKey(1)})
+	upload(t, fs, "secret.txt", []byte("attack at dawn"))
+	fs.Close()
+
+	fs = newTestService(t, Options{UploadDir: dir, KeyProvider: testKey(2)})
+	if _, err := download(fs, "secret.txt"); status.Code(err) != codes.DataLoss {
+		t.Errorf("download with the wrong key: got %v, want DataLoss", err)
+	}
+
+	fs.Close()
+	fs = newTestService(t, Options{UploadDir: dir})
+	if _, err := download(fs, "secret.txt"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("download without a key: got %v, want FailedPrecondition", err)
+	}
+}
+
+// Plain content that happens to start like an encrypted file must be served
+// as it is, with or without a key.
+func TestEncryptionMagicInPlaintext(t *testing.T) {
+	content := append(bytes.Clone(encMagic), "0123456789abcdef and then some text"...)
+
+	dir := t.TempDir()
+	fs := newTestService(t, Options{UploadDir: dir})
+	meta := upload(t, fs, "lookalike.txt", content)
+	if meta.Encrypted {
+		t.Error("upload without a key is recorded as encrypted")
+	}
+	if got, err := download(fs, "lookalike.txt"); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("download without a key = %q, %v; want %q", got, err, content)
+	}
+	fs.Close()
+
+	fs = newTestService(t, Options{UploadDir: dir, KeyProvider: testKey(1)})
+	if got, err := download(fs, "lookalike.txt"); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("download with a key = %q, %v; want %q", got, err, content)
+	}
+
+	dump, err := fs.GetHexdump(context.Background(), "lookalike.txt", 0)
+	if err != nil || dump.Length != len(content) {
+		t.Errorf("hexdump = %v, %v; want %d bytes", dump, err, len(content))
+	}
+
+	info, err := fs.GetFileInfo(context.Background(), "lookalike.txt")
+	if err != nil {
+		t.Fatalf("GetFileInfo: %v", err)
+	}
+	if info.Encrypted || info.SizeBytes != int64(len(content)) {
+		t.Errorf("file info = encrypted %v, size %d; want plain, size %d",
+			info.Encrypted, info.SizeBytes, len(content))
+	}
+}
@@ -1,164 +1,1208 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
-	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type FileMetadata struct {
-	Filename  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Filename          string    `json:"filename"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	ContentType       string    `json:"content_type,omitempty"`
+	SizeBytes         int64     `json:"size_bytes"`
+	PhysicalSizeBytes int64     `json:"physical_size_bytes,omitempty"`
+	SHA256            string    `json:"sha256,omitempty"`
+	Generation        int64     `json:"generation"`
+	Encrypted         bool      `json:"encrypted,omitempty"`
+	EncryptionNonce   string    `json:"encryption_nonce,omitempty"`
+	Quarantined       bool      `json:"quarantined,omitempty"`
+	QuarantineReason  string    `json:"quarantine_reason,omitempty"`
 }
 
+// Options configures a FileService.
+type Options struct {
+	UploadDir     string
+	UploadLimit   int64
+	DownloadLimit int64
+	ListLimit     int64
+	// LargeListLimit additionally bounds concurrent listings once the store
+	// holds LargeListThreshold files or more, since each such listing copies
+	// and sorts the whole index. Zero disables it.
+	LargeListLimit     int64
+	LargeListThreshold int
+	// MaxFileSize rejects uploads larger than this many bytes. Zero means
+	// unlimited.
+	MaxFileSize int64
+	// MinFreeInodes rejects uploads when the upload volume has fewer free
+	// inodes left. Zero disables the check.
+	MinFreeInodes uint64
+	// AllowedExtensions restricts uploads to filenames with one of these
+	// extensions, e.g. ".pdf", compared case-insensitively. Empty allows
+	// every name.
+	AllowedExtensions []string
+	// HideDotfiles leaves files starting with "." out of listings. They can
+	// still be downloaded by name.
+	HideDotfiles bool
+	// Scanner inspects every upload before it is published. Defaults to a
+	// scanner that accepts everything.
+	Scanner Scanner
+	// StrictContentType requires a declared content type to match the sniffed
+	// one exactly. Otherwise only the top-level type (e.g. "image") must match.
+	StrictContentType bool
+	// SnapshotInterval is how often metadata is flushed to disk, on top of
+	// the flush after every change and on Close. Zero disables it.
+	SnapshotInterval time.Duration
+	// MetadataWAL appends every metadata change to a write-ahead log instead
+	// of rewriting the whole snapshot after it. The log is replayed on
+	// startup and compacted into a snapshot every SnapshotInterval, on
+	// startup and on Close.
+	MetadataWAL bool
+	// PreviewMaxDimension bounds the width and height of image previews.
+	PreviewMaxDimension int
+	// HexdumpMaxBytes bounds how much of a file GetHexdump dumps.
+	HexdumpMaxBytes int
+	// CaseInsensitiveNames treats filenames differing only in case as the
+	// same file: uploading a case variant of an existing name is rejected
+	// and downloads resolve to the stored spelling. This avoids silent
+	// overwrites on case-insensitive filesystems, at the cost of refusing
+	// names a case-sensitive filesystem could hold side by side.
+	CaseInsensitiveNames bool
+	// KeyProvider enables encryption at rest for new uploads. Files already
+	// encrypted are read back with it regardless of when they were written.
+	KeyProvider KeyProvider
+	// SanitizeFilenames renames files found on startup whose names are not
+	// valid UTF-8, replacing the invalid bytes with "_". Otherwise such files
+	// are skipped, since their names cannot be sent over gRPC.
+	SanitizeFilenames bool
+	// MetadataShards is the number of independently locked shards the file
+	// metadata is split into. More shards mean less contention between
+	// concurrent uploads and listings. Defaults to 16.
+	MetadataShards int
+	// PartialUploadMaxAge removes interrupted resumable uploads untouched
+	// for longer than this on startup. Younger ones are kept so they can
+	// still be resumed after a quick restart. Zero keeps them all.
+	PartialUploadMaxAge time.Duration
+	// DirMode and FileMode are the permissions of the directories and files
+	// the service creates, applied regardless of the process umask. They
+	// default to 0755 and 0644.
+	DirMode  os.FileMode
+	FileMode os.FileMode
+	// BackfillContentTypes sniffs the content type of files found on
+	// startup that have none recorded. It reads the start of each such
+	// file, so it is off by default.
+	BackfillContentTypes bool
+}
+
+// UploadInfo describes an incoming upload.
+type UploadInfo struct {
+	Filename string
+	// ContentType is the type declared by the client. Empty skips the check.
+	ContentType string
+	// SHA256 is the hex encoded checksum declared by the client. Empty skips
+	// the check.
+	SHA256 string
+	// Resumable keeps the received bytes if the upload is interrupted, so
+	// it can be resumed from UploadOffset.
+	Resumable bool
+	// Offset is where a resumable upload continues, and must match
+	// UploadOffset.
+	Offset int64
+	// IfGenerationMatch only publishes the upload if the file's current
+	// generation equals it, with 0 meaning the file must not exist. Nil
+	// skips the check.
+	IfGenerationMatch *int64
+	// Overwrite allows replacing an existing file, which is otherwise
+	// rejected with AlreadyExists. A set IfGenerationMatch decides instead.
+	Overwrite bool
+	// Size is the size of the content declared by the client, used to
+	// reject uploads that will not fit on disk up front. Zero if unknown.
+	Size int64
+}
+
+// UploadResult says what an upload did to the stored file.
+type UploadResult int
+
+const (
+	// UploadCreated means the file did not exist before.
+	UploadCreated UploadResult = iota + 1
+	// UploadOverwritten means an existing file was replaced.
+	UploadOverwritten
+	// UploadUnchanged means the file already had the uploaded content and
+	// was left as it was.
+	UploadUnchanged
+)
+
 type FileService struct {
-	uploadDir    string
-	uploadSem    *semaphore.Weighted
-	downloadSem  *semaphore.Weighted
-	listSem      *semaphore.Weighted
-	metadata     map[string]FileMetadata
-	metadataLock sync.RWMutex
-	log          *slog.Logger
+	uploadDir      string
+	opts           Options
+	uploadSem      *limiter
+	downloadSem    *limiter
+	listSem        *limiter
+	largeListSem   *limiter
+	metadata       *metadataIndex
+	quarantine     map[string]FileMetadata
+	quarantineLock sync.RWMutex
+	snapshotLock   sync.Mutex
+	partialLock    sync.Mutex
+	resuming       map[string]bool
+	allowedExts    map[string]bool
+	masterKey      []byte
+	wal            *metadataWAL
+	snapshotStop   chan struct{}
+	snapshotDone   chan struct{}
+	log            *slog.Logger
 }
 
-func New(
-	uploadDir string,
-	uploadLimit, downloadLimit, listLimit int64,
-	log *slog.Logger,
-) (*FileService, error) {
+func New(opts Options, log *slog.Logger) (*FileService, error) {
+	if opts.DirMode == 0 {
+		opts.DirMode = defaultDirMode
+	}
+	if opts.FileMode == 0 {
+		opts.FileMode = defaultFileMode
+	}
+	if opts.Scanner == nil {
+		opts.Scanner = nopScanner{}
+	}
+	if opts.PreviewMaxDimension <= 0 {
+		opts.PreviewMaxDimension = defaultPreviewMaxDimension
+	}
+	if opts.HexdumpMaxBytes <= 0 {
+		opts.HexdumpMaxBytes = defaultHexdumpMaxBytes
+	}
+	if opts.MetadataShards <= 0 {
+		opts.MetadataShards = defaultMetadataShards
+	}
+	if opts.LargeListThreshold <= 0 {
+		opts.LargeListThreshold = defaultLargeListThreshold
+	}
+
+	fs := &FileService{
+		uploadDir:   opts.UploadDir,
+		opts:        opts,
+		uploadSem:   newLimiter("upload", opts.UploadLimit),
+		downloadSem: newLimiter("download", opts.DownloadLimit),
+		listSem:     newLimiter("list", opts.ListLimit),
+		metadata:    newMetadataIndex(opts.MetadataShards),
+		quarantine:  make(map[string]FileMetadata),
+		resuming:    make(map[string]bool),
+		log:         log,
+	}
 
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+	if err := fs.mkdirAll(opts.UploadDir); err != nil {
 		return nil, err
 	}
+	log.Info("file permissions",
+		"dir_mode", fmt.Sprintf("%#o", opts.DirMode), "file_mode", fmt.Sprintf("%#o", opts.FileMode))
 
-	fs := &FileService{
-		uploadDir:    uploadDir,
-		uploadSem:    semaphore.NewWeighted(uploadLimit),
-		downloadSem:  semaphore.NewWeighted(downloadLimit),
-		listSem:      semaphore.NewWeighted(listLimit),
-		metadata:     make(map[string]FileMetadata),
-		metadataLock: sync.RWMutex{},
-		log:          log,
+	if len(opts.AllowedExtensions) > 0 {
+		fs.allowedExts = make(map[string]bool)
+		for _, ext := range opts.AllowedExtensions {
+			ext = strings.ToLower(ext)
+			if ext != "" && !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			fs.allowedExts[ext] = true
+		}
+		log.Info("restricting uploads to extensions", "extensions", opts.AllowedExtensions)
+	}
+
+	if opts.LargeListLimit > 0 {
+		fs.largeListSem = newLimiter("large list", opts.LargeListLimit)
 	}
 
+	if opts.KeyProvider != nil {
+		key, err := opts.KeyProvider.MasterKey(context.Background())
+		if err != nil {
+			log.Error("failed to get encryption key", "error", err)
+			return nil, err
+		}
+		if len(key) != 32 {
+			log.Error("invalid encryption key", "size", len(key))
+			return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+		}
+		fs.masterKey = key
+	}
+
+	fs.cleanupTempFiles()
+
 	if err := fs.loadExistingFiles(); err != nil {
 		return nil, err
 	}
 
+	if err := fs.loadQuarantine(); err != nil {
+		return nil, err
+	}
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if opts.MetadataWAL {
+		wal, err := openWAL(filepath.Join(opts.UploadDir, walFile), opts.FileMode, log)
+		if err != nil {
+			log.Error("failed to open write-ahead log", "error", err)
+			return nil, err
+		}
+		fs.wal = wal
+		fs.metadata.journal = wal
+	} else if err := fs.dropWAL(); err != nil {
+		log.Error("failed to remove write-ahead log", "error", err)
+		return nil, err
+	}
+
+	changed := opts.BackfillContentTypes && fs.backfillContentTypes()
+	if changed || fs.wal != nil {
+		if err := fs.saveSnapshot(); err != nil {
+			fs.log.Error("failed to save metadata snapshot", "error", err)
+		}
+	}
+
+	if opts.SnapshotInterval > 0 {
+		fs.snapshotStop = make(chan struct{})
+		fs.snapshotDone = make(chan struct{})
+		go fs.runSnapshots(opts.SnapshotInterval)
+	}
+
 	return fs, nil
 }
 
 func (fs *FileService) loadExistingFiles() error {
-	files, err := os.ReadDir(fs.uploadDir)
-	if err != nil {
-		fs.log.Error("failed to read upload directory", "error", err)
-		return err
-	}
+	err := filepath.WalkDir(fs.uploadDir, func(fp string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if fp == fs.uploadDir {
+				return err
+			}
+			fs.log.Error("failed to read upload directory", "error", err, "path", fp)
+			return nil
+		}
+		if fp == fs.uploadDir {
+			return nil
+		}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
+		rel, err := filepath.Rel(fs.uploadDir, fp)
+		if err != nil {
+			return err
 		}
+		name := filepath.ToSlash(rel)
 
-		info, err := file.Info()
+		if isInternalFile(name) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
 		if err != nil {
-			fs.log.Error("failed to get file info", "error", err, "filename", file.Name())
-			continue
+			fs.log.Error("failed to get file info", "error", err, "filename", name)
+			return nil
 		}
 
-		fs.metadata[file.Name()] = FileMetadata{
-			Filename:  file.Name(),
-			CreatedAt: info.ModTime(),
-			UpdatedAt: info.ModTime(),
+		if !utf8.ValidString(name) {
+			var ok bool
+			if name, ok = fs.fixInvalidName(name); !ok {
+				return nil
+			}
 		}
+		if err := sanitizeFilename(name); err != nil {
+			fs.log.Warn("skipping file whose name cannot be served", "error", err, "filename", name)
+			return nil
+		}
+
+		key := fs.metadataKey(name)
+		if existing, ok := fs.metadata.get(key); ok {
+			fs.log.Warn("filenames collide case-insensitively, keeping the last one",
+				"filename", name, "previous", existing.Filename)
+		}
+
+		// only a guess until loadSnapshot overlays the file's record
+		nonce, encrypted := encryptionNonce(filepath.Join(fs.uploadDir, name))
+		size := info.Size()
+		if encrypted {
+			size = encryptedPlaintextSize(size)
+		}
+
+		fs.metadata.put(key, FileMetadata{
+			Filename:          name,
+			SizeBytes:         size,
+			PhysicalSizeBytes: info.Size(),
+			Generation:        1,
+			CreatedAt:         info.ModTime(),
+			UpdatedAt:         info.ModTime(),
+			Encrypted:         encrypted,
+			EncryptionNonce:   nonce,
+		})
+		return nil
+	})
+	if err != nil {
+		fs.log.Error("failed to read upload directory", "error", err)
+		return err
 	}
 
 	return nil
 }
 
+// fixInvalidName handles a file whose name is not valid UTF-8, either
+// renaming it to a sanitized name or skipping it. It reports the name to
+// load the file under and whether to load it at all.
+func (fs *FileService) fixInvalidName(name string) (string, bool) {
+	if !fs.opts.SanitizeFilenames {
+		fs.log.Warn("skipping file with invalid UTF-8 name", "filename", name)
+		return "", false
+	}
+
+	sanitized := strings.ToValidUTF8(name, "_")
+	if sanitizeFilename(sanitized) != nil || isInternalFile(sanitized) {
+		fs.log.Warn("skipping file with invalid UTF-8 name, no usable sanitized name",
+			"filename", name, "sanitized", sanitized)
+		return "", false
+	}
+
+	dst := filepath.Join(fs.uploadDir, sanitized)
+	if _, err := os.Lstat(dst); err == nil {
+		fs.log.Warn("skipping file with invalid UTF-8 name, sanitized name already exists",
+			"filename", name, "sanitized", sanitized)
+		return "", false
+	}
+
+	if err := fs.mkdirAll(filepath.Dir(dst)); err != nil {
+		fs.log.Error("failed to create directory for sanitized name", "error", err, "filename", name)
+		return "", false
+	}
+	if err := os.Rename(filepath.Join(fs.uploadDir, name), dst); err != nil {
+		fs.log.Error("failed to rename file with invalid UTF-8 name", "error", err, "filename", name)
+		return "", false
+	}
+
+	fs.log.Warn("renamed file with invalid UTF-8 name", "filename", name, "sanitized", sanitized)
+	return sanitized, true
+}
+
 type semaphoreReadCloser struct {
 	io.ReadCloser
-	sem *semaphore.Weighted
+	sem *limiter
 }
 
 func (src *semaphoreReadCloser) Close() error {
-	defer src.sem.Release(1)
+	defer src.sem.release()
 	return src.ReadCloser.Close()
 }
 
-func (fs *FileService) UploadFile(ctx context.Context, filename string, data io.Reader) error {
-	if err := fs.uploadSem.Acquire(ctx, 1); err != nil {
-		fs.log.Info("upload maximum connections reached")
+// UploadFile stores an upload and returns its metadata and what it did to
+// the stored file.
+func (fs *FileService) UploadFile(ctx context.Context, info UploadInfo, data io.Reader) (FileMetadata, UploadResult, error) {
+	filename := info.Filename
+	if err := sanitizeFilename(filename); err != nil {
+		return FileMetadata{}, 0, err
+	}
+	if isInternalFile(filename) {
+		return FileMetadata{}, 0, status.Errorf(codes.InvalidArgument, "filename %q is reserved", filename)
+	}
+	if err := fs.checkExtension(filename); err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	if err := fs.uploadSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return FileMetadata{}, 0, err
+	}
+	defer fs.uploadSem.release()
+
+	if err := fs.checkFreeInodes(); err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	if err := fs.checkFreeSpace(info); err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	if err := fs.checkCaseCollision(filename); err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	if err := fs.checkNotDirectory(filename); err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	// fail early before receiving the content, the check is repeated when
+	// the file is published
+	unlock := fs.metadata.rlock(fs.metadataKey(filename))
+	err := fs.checkPrecondition(info)
+	unlock()
+	if err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	if info.Resumable {
+		partial, err := fs.receivePartial(info, data)
+		if err != nil {
+			return FileMetadata{}, 0, err
+		}
+		defer fs.finishPartial(filename, partial)
+		data = partial
+	}
+
+	// write to a temp file first so an interrupted upload never replaces
+	// or shows up as the published file
+	tmp, err := fs.tempPath()
+	if err != nil {
+		return FileMetadata{}, 0, err
+	}
+	defer os.Remove(tmp)
+
+	meta, err := fs.writeFile(ctx, info, tmp, data)
+	if err != nil {
+		return FileMetadata{}, 0, err
+	}
+
+	now := time.Now()
+	meta.CreatedAt = now
+	meta.UpdatedAt = now
+
+	key := fs.metadataKey(filename)
+	unlock = fs.metadata.lock(key)
+	if err := fs.checkPrecondition(info); err != nil {
+		unlock()
+		return FileMetadata{}, 0, err
+	}
+	existing, exists := fs.metadata.get(key)
+	if exists && sameContent(existing, meta) {
+		unlock()
+		return existing, UploadUnchanged, nil
+	}
+	dst, err := fs.prepareDestination(filename)
+	if err != nil {
+		unlock()
+		return FileMetadata{}, 0, err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		unlock()
+		fs.logger(ctx).Error("failed to publish file", "error", err, "filename", filename)
+		return FileMetadata{}, 0, err
+	}
+	fs.publish(&meta)
+	unlock()
+
+	fs.persistMetadata()
+
+	if exists {
+		return meta, UploadOverwritten, nil
+	}
+	return meta, UploadCreated, nil
+}
+
+// sameContent reports whether an upload written as meta would leave the
+// stored file described by existing as it is.
+func sameContent(existing, meta FileMetadata) bool {
+	return !existing.Quarantined &&
+		existing.SHA256 != "" &&
+		existing.SHA256 == meta.SHA256 &&
+		existing.ContentType == meta.ContentType &&
+		existing.Encrypted == meta.Encrypted
+}
+
+// checkPrecondition checks that an upload may replace the file it names,
+// either by generation or by the overwrite flag. The caller must hold the
+// lock of the file's metadata shard.
+func (fs *FileService) checkPrecondition(info UploadInfo) error {
+	if info.IfGenerationMatch != nil {
+		return fs.checkGeneration(info.Filename, info.IfGenerationMatch)
+	}
+
+	if _, exists := fs.metadata.get(fs.metadataKey(info.Filename)); exists && !info.Overwrite {
+		return status.Errorf(codes.AlreadyExists, "file %q already exists", info.Filename)
+	}
+	return nil
+}
+
+// checkGeneration compares the file's current generation with the one the
+// client expects. The caller must hold the lock of the file's metadata shard.
+func (fs *FileService) checkGeneration(filename string, want *int64) error {
+	if want == nil {
+		return nil
+	}
+
+	meta, _ := fs.metadata.get(fs.metadataKey(filename))
+	current := meta.Generation
+	if current != *want {
+		return status.Errorf(codes.FailedPrecondition,
+			"file %q is at generation %d, expected %d", filename, current, *want)
+	}
+	return nil
+}
+
+// publish records meta as the new version of its file, keeping the original
+// creation time and bumping the generation. The caller must hold the write
+// lock of the file's metadata shard.
+func (fs *FileService) publish(meta *FileMetadata) {
+	key := fs.metadataKey(meta.Filename)
+	meta.Generation = 1
+	if existing, ok := fs.metadata.get(key); ok {
+		meta.CreatedAt = existing.CreatedAt
+		meta.Generation = existing.Generation + 1
+	}
+	fs.metadata.put(key, *meta)
+}
+
+// CheckWritable verifies that files can be created on the upload volume, to
+// catch a read-only or misconfigured mount before uploads fail.
+func (fs *FileService) CheckWritable() error {
+	fp, err := fs.tempPath()
+	if err != nil {
 		return err
 	}
-	defer fs.uploadSem.Release(1)
 
-	fp := filepath.Join(fs.uploadDir, filename)
-	file, err := os.Create(fp)
+	file, err := fs.createFile(fp, os.O_WRONLY|os.O_TRUNC)
 	if err != nil {
-		fs.log.Error("failed to create file", "error", err)
+		fs.log.Error("upload directory is not writable", "error", err)
 		return err
 	}
+	file.Close()
+
+	return os.Remove(fp)
+}
+
+// tempPath returns a unique path for an upload in the staging directory,
+// which is on the same filesystem as the published files and cleared on
+// startup.
+func (fs *FileService) tempPath() (string, error) {
+	dir := filepath.Join(fs.uploadDir, stagingDir)
+	if err := fs.mkdirAll(dir); err != nil {
+		fs.log.Error("failed to create staging directory", "error", err)
+		return "", err
+	}
+
+	return filepath.Join(dir, "upload-"+rand.Text()+".tmp"), nil
+}
+
+// writeFile writes uploaded content to fp, sniffing, encrypting and scanning
+// it on the way. The returned metadata has no timestamps set. On error the
+// caller removes whatever was written to fp.
+func (fs *FileService) writeFile(
+	ctx context.Context,
+	info UploadInfo,
+	fp string,
+	data io.Reader,
+) (FileMetadata, error) {
+
+	log := fs.logger(ctx)
+
+	filename := info.Filename
+
+	br := bufio.NewReaderSize(data, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		log.Error("failed to read file header", "error", err)
+		return FileMetadata{}, err
+	}
+
+	contentType := http.DetectContentType(head)
+	if err := fs.checkContentType(info.ContentType, contentType); err != nil {
+		return FileMetadata{}, err
+	}
+
+	file, err := fs.createFile(fp, os.O_RDWR|os.O_TRUNC)
+	if err != nil {
+		log.Error("failed to create file", "error", err)
+		return FileMetadata{}, err
+	}
 	defer file.Close()
 
-	if _, err := io.Copy(file, data); err != nil {
-		fs.log.Error("failed to write file", "error", err)
-		return err
+	var (
+		dst io.Writer = file
+		enc *encryptWriter
+	)
+	if fs.masterKey != nil {
+		if enc, err = newEncryptWriter(file, fs.masterKey); err != nil {
+			log.Error("failed to start encryption", "error", err)
+			return FileMetadata{}, err
+		}
+		dst = enc
 	}
 
-	now := time.Now()
-	fs.metadataLock.Lock()
-	defer fs.metadataLock.Unlock()
-	fs.metadata[filename] = FileMetadata{
-		Filename:  filename,
-		CreatedAt: now,
-		UpdatedAt: now,
+	var src io.Reader = br
+	if fs.opts.MaxFileSize > 0 {
+		// one byte past the limit is enough to tell the upload is too large
+		src = io.LimitReader(br, fs.opts.MaxFileSize+1)
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dst, hash), src)
+	if err != nil {
+		log.Error("failed to write file", "error", err)
+		return FileMetadata{}, err
+	}
+	if fs.opts.MaxFileSize > 0 && n > fs.opts.MaxFileSize {
+		log.Warn("file too large", "filename", filename, "limit", fs.opts.MaxFileSize)
+		return FileMetadata{}, status.Errorf(codes.ResourceExhausted,
+			"file %q exceeds the maximum size of %d bytes", filename, fs.opts.MaxFileSize)
+	}
+
+	var nonce []byte
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			log.Error("failed to write file", "error", err)
+			return FileMetadata{}, err
+		}
+		nonce = enc.nonce
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if info.SHA256 != "" && !strings.EqualFold(info.SHA256, sum) {
+		log.Error("checksum mismatch", "filename", filename, "expected", info.SHA256, "actual", sum)
+		return FileMetadata{}, status.Errorf(codes.DataLoss, "checksum mismatch for %q", filename)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		log.Error("failed to stat file", "error", err, "filename", filename)
+		return FileMetadata{}, err
+	}
+
+	if err := fs.scanFile(ctx, filename, fp, file, nonce); err != nil {
+		return FileMetadata{}, err
+	}
+
+	return FileMetadata{
+		Filename:          filename,
+		ContentType:       contentType,
+		SizeBytes:         n,
+		PhysicalSizeBytes: stat.Size(),
+		SHA256:            sum,
+		Encrypted:         enc != nil,
+		EncryptionNonce:   hex.EncodeToString(nonce),
+	}, nil
+}
+
+// defaultPreviewMaxDimension is used when no preview size is configured.
+const defaultPreviewMaxDimension = 256
+
+// defaultLargeListThreshold is the store size from which listings count as
+// large when no threshold is configured.
+const defaultLargeListThreshold = 10000
+
+// sniffLen is the number of leading bytes used to detect the content type.
+const sniffLen = 512
+
+// checkContentType compares the declared content type with the sniffed one.
+func (fs *FileService) checkContentType(declared, sniffed string) error {
+	if declared == "" {
+		return nil
+	}
+
+	want, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid content type %q", declared)
+	}
+	got, _, _ := mime.ParseMediaType(sniffed)
+
+	if !fs.opts.StrictContentType {
+		want, _, _ = strings.Cut(want, "/")
+		got, _, _ = strings.Cut(got, "/")
+	}
+
+	if want != got {
+		fs.log.Warn("content type mismatch", "declared", declared, "detected", sniffed)
+		return status.Errorf(codes.InvalidArgument,
+			"declared content type %q does not match detected %q", declared, sniffed)
+	}
+
+	return nil
+}
+
+// metadataKey returns the key a filename is stored under in the metadata map.
+func (fs *FileService) metadataKey(filename string) string {
+	if fs.opts.CaseInsensitiveNames {
+		return strings.ToLower(filename)
+	}
+	return filename
+}
+
+// lookup returns the metadata recorded for filename.
+func (fs *FileService) lookup(filename string) (FileMetadata, bool) {
+	key := fs.metadataKey(filename)
+	defer fs.metadata.rlock(key)()
+	return fs.metadata.get(key)
+}
+
+// resolveName maps a requested filename to the stored spelling when names
+// are case-insensitive, or to that of a quarantined upload if no file has
+// the name.
+func (fs *FileService) resolveName(filename string) string {
+	if !fs.opts.CaseInsensitiveNames {
+		return filename
+	}
+
+	if meta, ok := fs.lookup(filename); ok {
+		return meta.Filename
+	}
+
+	key := fs.metadataKey(filename)
+	fs.quarantineLock.RLock()
+	defer fs.quarantineLock.RUnlock()
+	for name := range fs.quarantine {
+		if fs.metadataKey(name) == key {
+			return name
+		}
+	}
+	return filename
+}
+
+// checkCaseCollision rejects an upload whose name differs only in case from
+// an existing file when names are case-insensitive.
+func (fs *FileService) checkCaseCollision(filename string) error {
+	if !fs.opts.CaseInsensitiveNames {
+		return nil
+	}
+
+	if meta, ok := fs.lookup(filename); ok && meta.Filename != filename {
+		return status.Errorf(codes.AlreadyExists,
+			"file %q conflicts with existing file %q", filename, meta.Filename)
+	}
+	return nil
+}
+
+// checkNotDirectory rejects a filename that would replace a directory in the
+// upload directory, such as one of the service's own.
+func (fs *FileService) checkNotDirectory(filename string) error {
+	info, err := os.Stat(filepath.Join(fs.uploadDir, filename))
+	if err == nil && info.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "filename %q is an existing directory", filename)
+	}
+	return nil
+}
+
+// checkExtension rejects filenames whose extension is not allowed, if
+// allowed extensions are configured.
+func (fs *FileService) checkExtension(filename string) error {
+	if fs.allowedExts == nil {
+		return nil
+	}
+	if ext := strings.ToLower(filepath.Ext(filename)); !fs.allowedExts[ext] {
+		return status.Errorf(codes.InvalidArgument, "extension %q of %q is not allowed", ext, filename)
+	}
+	return nil
+}
+
+// checkFreeInodes rejects the upload when the upload volume is running out of
+// inodes. The check is skipped where inode counts are unavailable.
+func (fs *FileService) checkFreeInodes() error {
+	if fs.opts.MinFreeInodes == 0 {
+		return nil
+	}
+
+	free, ok, err := freeInodes(fs.uploadDir)
+	if err != nil {
+		fs.log.Error("failed to stat upload directory", "error", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	if free < fs.opts.MinFreeInodes {
+		fs.log.Warn("not enough free inodes", "free", free, "min", fs.opts.MinFreeInodes)
+		return status.Errorf(codes.ResourceExhausted, "not enough free inodes on server")
+	}
+
+	return nil
+}
+
+// checkFreeSpace rejects an upload of declared size that would not fit on
+// the upload volume. Uploads without a declared size are not checked.
+func (fs *FileService) checkFreeSpace(info UploadInfo) error {
+	need := info.Size - info.Offset
+	if need <= 0 {
+		return nil
+	}
+
+	free, ok, err := freeBytes(fs.uploadDir)
+	if err != nil {
+		fs.log.Error("failed to stat upload directory", "error", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	if uint64(need) > free {
+		fs.log.Warn("not enough free disk space", "filename", info.Filename, "size", need, "free", free)
+		return status.Errorf(codes.ResourceExhausted,
+			"not enough disk space on server for %q: need %d bytes, %d available", info.Filename, need, free)
 	}
 
 	return nil
 }
 
-func (fs *FileService) DownloadFile(ctx context.Context, filename string) (io.ReadCloser, error) {
-	if err := fs.downloadSem.Acquire(ctx, 1); err != nil {
-		fs.log.Info("download maximum connections reached")
+// Download is a stored file opened for reading its plaintext. Closing it
+// frees its download slot.
+type Download struct {
+	io.ReadCloser
+	// Size is the number of plaintext bytes the download yields, or -1 if
+	// it is not known.
+	Size int64
+}
+
+func (fs *FileService) DownloadFile(ctx context.Context, filename string) (*Download, error) {
+	if err := fs.checkReadable(filename); err != nil {
+		return nil, err
+	}
+	filename = fs.resolveName(filename)
+	if err := fs.checkQuarantine(filename); err != nil {
+		return nil, err
+	}
+
+	if err := fs.downloadSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return nil, err
+	}
+
+	file, err := fs.openFile(filename)
+	if err != nil {
+		fs.downloadSem.release()
+		fs.logger(ctx).Error("failed to open file", "error", err)
+		return nil, err
+	}
+
+	size := int64(-1)
+	if meta, ok := fs.lookup(filename); ok {
+		size = meta.SizeBytes
+	}
+
+	return &Download{
+		ReadCloser: &semaphoreReadCloser{
+			ReadCloser: file,
+			sem:        fs.downloadSem,
+		},
+		Size: size,
+	}, nil
+}
+
+// DownloadRange opens length bytes of a stored file's plaintext starting at
+// offset, or everything from offset if length is 0. A range running past the
+// end of the file is cut short; an offset past it fails with OutOfRange.
+func (fs *FileService) DownloadRange(ctx context.Context, filename string, offset, length int64) (*Download, error) {
+	if offset < 0 || length < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid range: offset %d, length %d", offset, length)
+	}
+	if offset == 0 && length == 0 {
+		return fs.DownloadFile(ctx, filename)
+	}
+	if err := fs.checkReadable(filename); err != nil {
+		return nil, err
+	}
+	filename = fs.resolveName(filename)
+	if err := fs.checkQuarantine(filename); err != nil {
+		return nil, err
+	}
+
+	log := fs.logger(ctx)
+	if err := fs.downloadSem.acquire(ctx, log); err != nil {
 		return nil, err
 	}
 
-	filePath := filepath.Join(fs.uploadDir, filename)
-	file, err := os.Open(filePath)
+	file, size, err := fs.openFileAt(filename, offset)
 	if err != nil {
-		fs.downloadSem.Release(1)
-		fs.log.Error("failed to open file", "error", err)
+		fs.downloadSem.release()
+		if status.Code(err) == codes.OutOfRange {
+			log.Warn("download offset out of range", "filename", filename, "offset", offset)
+		} else {
+			log.Error("failed to open file", "error", err)
+		}
 		return nil, err
 	}
 
-	return &semaphoreReadCloser{
-		ReadCloser: file,
-		sem:        fs.downloadSem,
+	var r io.Reader = file
+	size -= offset
+	if length > 0 && length < size {
+		r = io.LimitReader(file, length)
+		size = length
+	}
+
+	return &Download{
+		ReadCloser: &semaphoreReadCloser{
+			ReadCloser: struct {
+				io.Reader
+				io.Closer
+			}{r, file},
+			sem: fs.downloadSem,
+		},
+		Size: size,
 	}, nil
 }
 
-func (fs *FileService) ListFiles(ctx context.Context) ([]FileMetadata, error) {
-	if err := fs.listSem.Acquire(ctx, 1); err != nil {
-		fs.log.Info("list files maximum connections reached")
+// ListFiles returns the visible files sorted by name. A non-empty pattern,
+// in filepath.Match syntax, keeps only the files whose name matches it.
+func (fs *FileService) ListFiles(ctx context.Context, pattern string) ([]FileMetadata, error) {
+	if err := checkPattern(pattern); err != nil {
 		return nil, err
 	}
-	defer fs.listSem.Release(1)
 
-	fs.metadataLock.RLock()
-	defer fs.metadataLock.RUnlock()
+	release, err := fs.acquireList(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	files := make([]FileMetadata, 0, len(fs.metadata))
-	for _, meta := range fs.metadata {
+	all := fs.metadata.all()
+	files := all[:0]
+	for _, meta := range all {
+		if fs.isHidden(meta.Filename) {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, meta.Filename); !ok {
+				continue
+			}
+		}
 		files = append(files, meta)
 	}
 
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Filename < files[j].Filename
+	})
+
 	return files, nil
 }
+
+// sanitizeFilename is the one place filenames are validated, for every
+// operation taking one. It rejects names that could resolve outside the
+// upload directory. Filenames may contain "/" separated subdirectories, e.g.
+// "2024/q1/report.pdf", but must be clean relative paths: no "..", empty
+// or "." elements, backslashes or leading "/". A trailing separator is
+// reported as naming a directory. Blank names, elements with leading or
+// trailing whitespace and control characters such as newlines are rejected
+// too, as they are near impossible to tell apart in listings and logs.
+func sanitizeFilename(filename string) error {
+	if strings.TrimSpace(filename) == "" {
+		return status.Error(codes.InvalidArgument, "empty filename")
+	}
+	if strings.IndexFunc(filename, unicode.IsControl) >= 0 {
+		return status.Errorf(codes.InvalidArgument, "filename %q contains control characters", filename)
+	}
+	for _, elem := range strings.Split(filename, "/") {
+		if strings.TrimSpace(elem) != elem {
+			return status.Errorf(codes.InvalidArgument, "filename %q has leading or trailing whitespace", filename)
+		}
+	}
+	if strings.HasSuffix(filename, "/") || strings.HasSuffix(filename, "\\") {
+		return status.Errorf(codes.InvalidArgument, "filename %q names a directory", filename)
+	}
+	if strings.Contains(filename, "\\") ||
+		strings.Contains(filename, "..") ||
+		path.Clean(filename) != filename ||
+		!filepath.IsLocal(filename) {
+		return status.Errorf(codes.InvalidArgument, "invalid filename %q", filename)
+	}
+	return nil
+}
+
+// checkReadable validates filename for an operation reading a stored file.
+// The service's own files, such as the metadata snapshot or quarantined
+// uploads, are not found, the same as they are left out of listings.
+func (fs *FileService) checkReadable(filename string) error {
+	if err := sanitizeFilename(filename); err != nil {
+		return err
+	}
+	if isInternalFile(fs.metadataKey(filename)) {
+		return status.Errorf(codes.NotFound, "file %q not found", filename)
+	}
+	return nil
+}
+
+// ValidateFilename checks filename the way every FileService operation
+// does, for callers that want to reject a request before starting on it.
+func ValidateFilename(filename string) error {
+	return sanitizeFilename(filename)
+}
+
+// filePath returns where filename is stored. It fails if the name, once
+// cleaned, would not stay inside the upload directory.
+func (fs *FileService) filePath(filename string) (string, error) {
+	fp := filepath.Join(fs.uploadDir, filepath.FromSlash(filename))
+	rel, err := filepath.Rel(fs.uploadDir, fp)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", status.Errorf(codes.InvalidArgument, "invalid filename %q", filename)
+	}
+	return fp, nil
+}
+
+// prepareDestination returns where filename is published, creating its
+// parent directories. It fails if a parent is an existing file or the name
+// itself is an existing directory.
+func (fs *FileService) prepareDestination(filename string) (string, error) {
+	fp, err := fs.filePath(filename)
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(fp); err == nil && info.IsDir() {
+		return "", status.Errorf(codes.FailedPrecondition, "filename %q names a directory", filename)
+	}
+
+	if err := fs.mkdirAll(filepath.Dir(fp)); err != nil {
+		if errors.Is(err, syscall.ENOTDIR) {
+			return "", status.Errorf(codes.FailedPrecondition,
+				"a parent directory of %q is an existing file", filename)
+		}
+		fs.log.Error("failed to create directory", "error", err, "filename", filename)
+		return "", err
+	}
+
+	return fp, nil
+}
+
+// checkPattern rejects malformed filepath.Match patterns, which would
+// otherwise silently match nothing.
+func checkPattern(pattern string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid pattern %q", pattern)
+	}
+	return nil
+}
+
+// WalkFiles calls fn for every listed file sorting strictly after
+// startAfter and matching pattern, in filename order. Only the names are
+// collected and sorted up front, under a list slot; each file's metadata is
+// read when its turn comes, so files renamed away in the meantime are
+// skipped. An error from fn stops the walk and is returned.
+func (fs *FileService) WalkFiles(
+	ctx context.Context,
+	startAfter, pattern string,
+	fn func(FileMetadata) error,
+) error {
+
+	names, err := fs.listNames(ctx, startAfter, pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		meta, ok := fs.lookup(name)
+		if !ok || meta.Filename != name {
+			continue
+		}
+		if err := fn(meta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listNames returns the sorted names WalkFiles visits.
+func (fs *FileService) listNames(ctx context.Context, startAfter, pattern string) ([]string, error) {
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+
+	release, err := fs.acquireList(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	all := fs.metadata.names()
+	names := all[:0]
+	for _, name := range all {
+		if name <= startAfter || fs.isHidden(name) {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, name); !ok {
+				continue
+			}
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// FilesAfter returns the files of a listing sorted by name that come
+// strictly after startAfter.
+func FilesAfter(files []FileMetadata, startAfter string) []FileMetadata {
+	i := sort.Search(len(files), func(i int) bool {
+		return files[i].Filename > startAfter
+	})
+
+	return files[i:]
+}
+
+// acquireList takes a list slot for a listing, which scans the whole index
+// if scan is set. Such a listing of a store with LargeListThreshold files or
+// more takes a large list slot as well, whatever its pattern or page, since
+// it copies and walks every entry anyway. The large list slot is taken
+// first, so no list slot is held while waiting for one. The returned func
+// releases the slots.
+func (fs *FileService) acquireList(ctx context.Context, scan bool) (func(), error) {
+	log := fs.logger(ctx)
+
+	large := scan && fs.largeListSem != nil && fs.fileCount() >= fs.opts.LargeListThreshold
+	if large {
+		if err := fs.largeListSem.acquire(ctx, log); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fs.listSem.acquire(ctx, log); err != nil {
+		if large {
+			fs.largeListSem.release()
+		}
+		return nil, err
+	}
+
+	return func() {
+		fs.listSem.release()
+		if large {
+			fs.largeListSem.release()
+		}
+	}, nil
+}
+
+// fileCount returns the number of stored files.
+func (fs *FileService) fileCount() int {
+	return fs.metadata.len()
+}
+
+// isHidden reports whether the file should be left out of listings.
+func (fs *FileService) isHidden(filename string) bool {
+	if !fs.opts.HideDotfiles {
+		return false
+	}
+	for _, elem := range strings.Split(filename, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		valid    bool
+	}{
+		{"report.pdf", true},
+		{"2024/q1/report.pdf", true},
+		{".hidden", true},
+		{"../etc/passwd", false},
+		{"a/../b", false},
+		{"a/..", false},
+		{"..", false},
+		{"/etc/passwd", false},
+		{"a\\b", false},
+		{"..\\secret", false},
+		{"C:\\secret", false},
+		{"a//b", false},
+		{"./a", false},
+		{"dir/", false},
+		{"", false},
+		{"  ", false},
+		{" a", false},
+		{"a\nb", false},
+	}
+	for _, tt := range tests {
+		err := sanitizeFilename(tt.filename)
+		if tt.valid && err != nil {
+			t.Errorf("sanitizeFilename(%q) = %v, want nil", tt.filename, err)
+		}
+		if !tt.valid && status.Code(err) != codes.InvalidArgument {
+			t.Errorf("sanitizeFilename(%q) = %v, want InvalidArgument", tt.filename, err)
+		}
+	}
+}
+
+func TestCheckReadableInternalFiles(t *testing.T) {
+	fs := newTestService(t, Options{})
+
+	for _, filename := range []string{
+		metadataFile,
+		metadataFile + ".tmp",
+		walFile,
+		walFile + ".old",
+		stagingDir + "/tx/report.pdf",
+		partialDir + "/report.pdf",
+		quarantineDir + "/report.pdf",
+		previewDir + "/thumb.png",
+	} {
+		if err := sanitizeFilename(filename); err != nil {
+			t.Errorf("sanitizeFilename(%q) = %v, want nil", filename, err)
+		}
+		if err := fs.checkReadable(filename); status.Code(err) != codes.NotFound {
+			t.Errorf("checkReadable(%q) = %v, want NotFound", filename, err)
+		}
+	}
+
+	if err := fs.checkReadable("quarantine/report.pdf"); err != nil {
+		t.Errorf("checkReadable of an uploaded file = %v, want nil", err)
+	}
+}
+
+// Every listing of a large store waits for a large list slot, whichever
+// method it comes through, without holding a list slot meanwhile.
+func TestLargeListLimit(t *testing.T) {
+	fs := newTestService(t, Options{LargeListLimit: 1, LargeListThreshold: 2})
+	upload(t, fs, "a.txt", []byte("a"))
+	upload(t, fs, "b.txt", []byte("b"))
+
+	if err := fs.largeListSem.acquire(context.Background(), fs.log); err != nil {
+		t.Fatal(err)
+	}
+	defer fs.largeListSem.release()
+
+	listings := map[string]func(context.Context) error{
+		"ListFiles": func(ctx context.Context) error {
+			_, err := fs.ListFiles(ctx, "")
+			return err
+		},
+		"ListFiles with pattern": func(ctx context.Context) error {
+			_, err := fs.ListFiles(ctx, "a*")
+			return err
+		},
+		"WalkFiles": func(ctx context.Context) error {
+			return fs.WalkFiles(ctx, "", "", func(FileMetadata) error { return nil })
+		},
+		"StatFiles with pattern": func(ctx context.Context) error {
+			_, err := fs.StatFiles(ctx, nil, "*")
+			return err
+		},
+	}
+	for name, list := range listings {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- list(ctx) }()
+
+		if !waitQueued(fs.largeListSem, done) {
+			cancel()
+			t.Errorf("%s: did not wait for a large list slot", name)
+			continue
+		}
+		if n := fs.listSem.inUse.Load(); n != 0 {
+			t.Errorf("%s: %d list slots held while waiting, want 0", name, n)
+		}
+
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: got %v, want Canceled", name, err)
+		}
+	}
+
+	if _, err := fs.StatFiles(context.Background(), []string{"a.txt"}, ""); err != nil {
+		t.Errorf("StatFiles of names only: %v", err)
+	}
+}
+
+// waitQueued waits until an operation queues on l, and reports false if it
+// finishes on done instead.
+func waitQueued(l *limiter, done <-chan error) bool {
+	for l.waiting.Load() == 0 {
+		select {
+		case <-done:
+			return false
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return true
+}
+
+// Two uploads of one name racing each other leave one of the two inputs
+// complete, and a download running alongside never sees a mix.
+func TestConcurrentUploadSameName(t *testing.T) {
+	fs := newTestService(t, Options{})
+
+	inputs := [][]byte{
+		bytes.Repeat([]byte("a"), 1<<20),
+		bytes.Repeat([]byte("b"), 1<<20),
+	}
+	isInput := func(got []byte) bool {
+		return bytes.Equal(got, inputs[0]) || bytes.Equal(got, inputs[1])
+	}
+
+	for range 20 {
+		var wg sync.WaitGroup
+		for _, content := range inputs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				info := UploadInfo{Filename: "race.bin", Overwrite: true}
+				if _, _, err := fs.UploadFile(context.Background(), info, bytes.NewReader(content)); err != nil {
+					t.Errorf("UploadFile: %v", err)
+				}
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := download(fs, "race.bin")
+			if err == nil && !isInput(got) {
+				t.Error("download during the race returned a mix of both uploads")
+			}
+		}()
+		wg.Wait()
+
+		got, err := download(fs, "race.bin")
+		if err != nil {
+			t.Fatalf("download: %v", err)
+		}
+		if !isInput(got) {
+			t.Fatal("stored file is a mix of both uploads")
+		}
+		meta, err := fs.GetFileInfo(context.Background(), "race.bin")
+		if err != nil {
+			t.Fatalf("GetFileInfo: %v", err)
+		}
+		if sum := sha256.Sum256(got); meta.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Fatal("metadata describes the other upload")
+		}
+	}
+}
+
+// cancelReader returns head, then blocks until ctx is done, like a stream
+// whose client goes away partway through an upload.
+type cancelReader struct {
+	ctx  context.Context
+	head []byte
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	if len(r.head) > 0 {
+		n := copy(p, r.head)
+		r.head = r.head[n:]
+		return n, nil
+	}
+	<-r.ctx.Done()
+	return 0, r.ctx.Err()
+}
+
+// An upload cancelled partway through leaves no trace: no staged or
+// published file and no metadata.
+func TestUploadCancelled(t *testing.T) {
+	dir := t.TempDir()
+	fs := newTestService(t, Options{UploadDir: dir})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		data := &cancelReader{ctx: ctx, head: bytes.Repeat([]byte("x"), 64<<10)}
+		_, _, err := fs.UploadFile(ctx, UploadInfo{Filename: "partial.bin"}, data)
+		done <- err
+	}()
+
+	// wait until the upload has started writing its staged file
+	staging := filepath.Join(dir, stagingDir)
+	for {
+		if entries, _ := os.ReadDir(staging); len(entries) > 0 {
+			break
+		}
+		select {
+		case err := <-done:
+			t.Fatalf("UploadFile finished before it was cancelled: %v", err)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("UploadFile = %v, want Canceled", err)
+	}
+
+	if entries, err := os.ReadDir(staging); err != nil || len(entries) != 0 {
+		t.Errorf("staging directory holds %d files (%v), want none", len(entries), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partial.bin")); !os.IsNotExist(err) {
+		t.Errorf("published file: stat = %v, want not exist", err)
+	}
+	if _, err := fs.GetFileInfo(context.Background(), "partial.bin"); status.Code(err) != codes.NotFound {
+		t.Errorf("GetFileInfo = %v, want NotFound", err)
+	}
+	files, err := fs.ListFiles(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListFiles: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("ListFiles returned %d files, want none", len(files))
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	fs := newTestService(t, Options{UploadDir: dir, MaxFileSize: 1000})
+
+	meta := upload(t, fs, "small.bin", make([]byte, 1000))
+	if meta.SizeBytes != 1000 {
+		t.Errorf("size = %d, want 1000", meta.SizeBytes)
+	}
+
+	_, _, err := fs.UploadFile(context.Background(), UploadInfo{Filename: "large.bin"}, bytes.NewReader(make([]byte, 1001)))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("upload over the limit = %v, want ResourceExhausted", err)
+	}
+	if _, err := fs.GetFileInfo(context.Background(), "large.bin"); status.Code(err) != codes.NotFound {
+		t.Errorf("GetFileInfo of the rejected file = %v, want NotFound", err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(dir, stagingDir)); err != nil || len(entries) != 0 {
+		t.Errorf("staging directory holds %d files (%v), want none", len(entries), err)
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+)
+
+// defaultHexdumpMaxBytes is used when no hexdump size is configured.
+const defaultHexdumpMaxBytes = 512
+
+// Hexdump is the start of a file formatted like `hexdump -C`: offset, hex
+// bytes and their ASCII rendering, 16 bytes per line.
+type Hexdump struct {
+	Dump string
+	// Length is the number of bytes dumped.
+	Length int
+	// Truncated reports whether the file continues past the dump.
+	Truncated bool
+}
+
+// GetHexdump dumps the first n bytes of a file, or HexdumpMaxBytes if n is
+// zero or larger.
+func (fs *FileService) GetHexdump(ctx context.Context, filename string, n int) (*Hexdump, error) {
+	if err := fs.checkReadable(filename); err != nil {
+		return nil, err
+	}
+
+	if n <= 0 || n > fs.opts.HexdumpMaxBytes {
+		n = fs.opts.HexdumpMaxBytes
+	}
+
+	if err := fs.downloadSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return nil, err
+	}
+	defer fs.downloadSem.release()
+
+	// one byte more tells whether the file is longer than the dump
+	buf := make([]byte, n+1)
+	var read int
+	if err := fs.readFile(filename, func(r io.Reader) (err error) {
+		read, err = io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+		return err
+	}); err != nil {
+		fs.logger(ctx).Error("failed to read file", "error", err, "filename", filename)
+		return nil, err
+	}
+
+	truncated := read > n
+	if truncated {
+		read = n
+	}
+
+	return &Hexdump{
+		Dump:      hex.Dump(buf[:read]),
+		Length:    read,
+		Truncated: truncated,
+	}, nil
+}
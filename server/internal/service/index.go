@@ -0,0 +1,205 @@
+package service
+
+import (
+	"hash/maphash"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMetadataShards is used when no shard count is configured.
+const defaultMetadataShards = 16
+
+// metadataIndex holds the metadata of the stored files by metadataKey. It is
+// split into shards with their own locks, so uploads of different files and
+// listings running alongside them rarely wait on each other.
+//
+// get and put expect the caller to hold the lock of the key's shard, taken
+// with rlock or lock. Startup runs before any request and needs no locks.
+//
+// Alongside, put and delete maintain an index from content checksum to the
+// keys holding that content. It has its own lock, taken inside the shard
+// locks, so bySum may be called without holding any.
+type metadataIndex struct {
+	seed   maphash.Seed
+	shards []metadataShard
+	// bytes is the total size of all records, kept up to date by put and
+	// delete
+	bytes atomic.Int64
+
+	sumLock sync.Mutex
+	sums    map[string]map[string]bool
+
+	// journal records every put and delete once set, see metadataWAL
+	journal *metadataWAL
+}
+
+type metadataShard struct {
+	sync.RWMutex
+	files map[string]FileMetadata
+}
+
+func newMetadataIndex(shards int) *metadataIndex {
+	idx := &metadataIndex{
+		seed:   maphash.MakeSeed(),
+		shards: make([]metadataShard, shards),
+		sums:   make(map[string]map[string]bool),
+	}
+	for i := range idx.shards {
+		idx.shards[i].files = make(map[string]FileMetadata)
+	}
+	return idx
+}
+
+func (idx *metadataIndex) shardIndex(key string) int {
+	return int(maphash.String(idx.seed, key) % uint64(len(idx.shards)))
+}
+
+// rlock read-locks the shard of key and returns the matching unlock.
+func (idx *metadataIndex) rlock(key string) func() {
+	shard := &idx.shards[idx.shardIndex(key)]
+	shard.RLock()
+	return shard.RUnlock
+}
+
+// lock write-locks the shards of all keys and returns a function unlocking
+// them. Shards are locked in index order, so callers locking overlapping sets
+// cannot deadlock.
+func (idx *metadataIndex) lock(keys ...string) func() {
+	var locked []int
+	for _, key := range keys {
+		locked = append(locked, idx.shardIndex(key))
+	}
+	slices.Sort(locked)
+	locked = slices.Compact(locked)
+
+	for _, i := range locked {
+		idx.shards[i].Lock()
+	}
+	return func() {
+		for _, i := range locked {
+			idx.shards[i].Unlock()
+		}
+	}
+}
+
+func (idx *metadataIndex) get(key string) (FileMetadata, bool) {
+	meta, ok := idx.shards[idx.shardIndex(key)].files[key]
+	return meta, ok
+}
+
+func (idx *metadataIndex) put(key string, meta FileMetadata) {
+	files := idx.shards[idx.shardIndex(key)].files
+	if old, ok := files[key]; ok {
+		idx.unindexSum(key, old.SHA256)
+		idx.bytes.Add(-old.SizeBytes)
+	}
+	files[key] = meta
+	idx.bytes.Add(meta.SizeBytes)
+	idx.indexSum(key, meta.SHA256)
+	idx.journal.record(walPut, meta)
+}
+
+func (idx *metadataIndex) delete(key string) {
+	files := idx.shards[idx.shardIndex(key)].files
+	if old, ok := files[key]; ok {
+		idx.unindexSum(key, old.SHA256)
+		idx.bytes.Add(-old.SizeBytes)
+		idx.journal.record(walDelete, old)
+	}
+	delete(files, key)
+}
+
+func (idx *metadataIndex) indexSum(key, sum string) {
+	if sum == "" {
+		return
+	}
+	sum = strings.ToLower(sum)
+
+	idx.sumLock.Lock()
+	defer idx.sumLock.Unlock()
+
+	keys := idx.sums[sum]
+	if keys == nil {
+		keys = make(map[string]bool)
+		idx.sums[sum] = keys
+	}
+	keys[key] = true
+}
+
+func (idx *metadataIndex) unindexSum(key, sum string) {
+	if sum == "" {
+		return
+	}
+	sum = strings.ToLower(sum)
+
+	idx.sumLock.Lock()
+	defer idx.sumLock.Unlock()
+
+	delete(idx.sums[sum], key)
+	if len(idx.sums[sum]) == 0 {
+		delete(idx.sums, sum)
+	}
+}
+
+// bySum returns the keys of the records whose content has the given hex
+// encoded SHA-256, in no particular order.
+func (idx *metadataIndex) bySum(sum string) []string {
+	idx.sumLock.Lock()
+	defer idx.sumLock.Unlock()
+
+	matches := idx.sums[strings.ToLower(sum)]
+	keys := make([]string, 0, len(matches))
+	for key := range matches {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// all returns a copy of every record, read-locking one shard at a time. It
+// is not a point-in-time view across shards, which listings do not need.
+func (idx *metadataIndex) all() []FileMetadata {
+	files := make([]FileMetadata, 0, idx.len())
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.RLock()
+		for _, meta := range shard.files {
+			files = append(files, meta)
+		}
+		shard.RUnlock()
+	}
+	return files
+}
+
+// names returns the filename of every record, read-locking one shard at a
+// time like all.
+func (idx *metadataIndex) names() []string {
+	names := make([]string, 0, idx.len())
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.RLock()
+		for _, meta := range shard.files {
+			names = append(names, meta.Filename)
+		}
+		shard.RUnlock()
+	}
+	return names
+}
+
+// size returns the total size of all records.
+func (idx *metadataIndex) size() int64 {
+	return idx.bytes.Load()
+}
+
+// len returns the number of records.
+func (idx *metadataIndex) len() int {
+	n := 0
+	for i := range idx.shards {
+		shard := &idx.shards[i]
+		shard.RLock()
+		n += len(shard.files)
+		shard.RUnlock()
+	}
+	return n
+}
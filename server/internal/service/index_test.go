@@ -0,0 +1,46 @@
+package service
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkMetadataContention mixes lookups, uploads and listings of the
+// metadata from many goroutines, with a single shard standing in for the
+// global lock the index had before it was sharded.
+func BenchmarkMetadataContention(b *testing.B) {
+	const files = 1000
+	for _, shards := range []int{1, defaultMetadataShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			idx := newMetadataIndex(shards)
+			keys := make([]string, files)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("file-%d.txt", i)
+				idx.put(keys[i], FileMetadata{Filename: keys[i], SizeBytes: 1})
+			}
+
+			var workers atomic.Int64
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				offset := int(workers.Add(1)) * 7
+				for i := 0; pb.Next(); i++ {
+					key := keys[(offset+i)%files]
+					switch {
+					case i%100 == 0:
+						idx.all()
+					case i%4 == 0:
+						unlock := idx.lock(key)
+						idx.put(key, FileMetadata{Filename: key, SizeBytes: int64(i)})
+						unlock()
+					default:
+						unlock := idx.rlock(key)
+						idx.get(key)
+						unlock()
+					}
+				}
+			})
+		})
+	}
+}
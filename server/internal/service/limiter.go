@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// limiter bounds the number of concurrent operations of one kind and keeps
+// track of how many are in flight and how many are waiting. Slots are handed
+// out in arrival order: semaphore.Weighted queues waiters FIFO, and neither
+// Acquire nor TryAcquire takes a free slot while anyone is queued, so a
+// waiting upload cannot be overtaken by later ones.
+type limiter struct {
+	name    string
+	size    int64
+	sem     *semaphore.Weighted
+	inUse   atomic.Int64
+	waiting atomic.Int64
+}
+
+func newLimiter(name string, size int64) *limiter {
+	return &limiter{
+		name: name,
+		size: size,
+		sem:  semaphore.NewWeighted(size),
+	}
+}
+
+// acquire takes a slot, waiting for one to free up if the limit is saturated.
+// Waiting and giving up are both logged so operators can tune the limits.
+func (l *limiter) acquire(ctx context.Context, log *slog.Logger) error {
+	if l.sem.TryAcquire(1) {
+		l.inUse.Add(1)
+		return nil
+	}
+
+	start := time.Now()
+	queued := l.waiting.Add(1)
+	err := l.sem.Acquire(ctx, 1)
+	l.waiting.Add(-1)
+	if err != nil {
+		log.Warn("concurrency limit reached, request rejected",
+			"limit", l.name,
+			"in_use", l.inUse.Load(),
+			"max", l.size,
+			"queued", queued,
+			"waited", time.Since(start),
+			"error", err,
+		)
+		return err
+	}
+	l.inUse.Add(1)
+
+	log.Warn("concurrency limit reached, request delayed",
+		"limit", l.name,
+		"in_use", l.inUse.Load(),
+		"max", l.size,
+		"queued", queued,
+		"waited", time.Since(start),
+	)
+	return nil
+}
+
+func (l *limiter) release() {
+	l.inUse.Add(-1)
+	l.sem.Release(1)
+}
+
+// InFlight counts operations by kind, either those holding a slot or those
+// waiting for one.
+type InFlight struct {
+	Uploads   int64
+	Downloads int64
+	Lists     int64
+}
+
+// InFlight reports how many operations are running. Uploads include open
+// transactions, downloads last until their reader is closed.
+func (fs *FileService) InFlight() InFlight {
+	return InFlight{
+		Uploads:   fs.uploadSem.inUse.Load(),
+		Downloads: fs.downloadSem.inUse.Load(),
+		Lists:     fs.listSem.inUse.Load(),
+	}
+}
+
+// Queued reports how many operations are waiting for a slot because their
+// limit is saturated.
+func (fs *FileService) Queued() InFlight {
+	return InFlight{
+		Uploads:   fs.uploadSem.waiting.Load(),
+		Downloads: fs.downloadSem.waiting.Load(),
+		Lists:     fs.listSem.waiting.Load(),
+	}
+}
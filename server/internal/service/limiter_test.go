@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// Requests queued on a saturated limiter get their slots in arrival order.
+func TestLimiterFIFO(t *testing.T) {
+	l := newLimiter("upload", 1)
+	log := slog.New(slog.DiscardHandler)
+	if err := l.acquire(context.Background(), log); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	order := make(chan int, n)
+	for i := range n {
+		done := make(chan error, 1)
+		go func() {
+			err := l.acquire(context.Background(), log)
+			if err == nil {
+				order <- i
+				l.release()
+			}
+			done <- err
+		}()
+		// queue the next request only once this one is waiting
+		for l.waiting.Load() != int64(i+1) {
+			select {
+			case err := <-done:
+				t.Fatalf("request %d did not wait: %v", i, err)
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	l.release()
+	for want := range n {
+		if got := <-order; got != want {
+			t.Fatalf("slot %d went to request %d, want request %d", want, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// WithLogger returns a copy of ctx carrying log. FileService methods called
+// with such a context log through it instead of the service's own logger,
+// e.g. to tag their messages with the ID of the request they serve.
+func WithLogger(ctx context.Context, log *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// LoggerFrom returns the logger carried by ctx, or fallback if it has none.
+func LoggerFrom(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if log, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return log
+	}
+	return fallback
+}
+
+func (fs *FileService) logger(ctx context.Context) *slog.Logger {
+	return LoggerFrom(ctx, fs.log)
+}
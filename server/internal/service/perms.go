@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+const (
+	defaultDirMode  os.FileMode = 0755
+	defaultFileMode os.FileMode = 0644
+)
+
+// mkdirAll creates dir and any missing parents with DirMode. The mode is
+// applied as configured rather than narrowed by the process umask, existing
+// directories are left as they are.
+func (fs *FileService) mkdirAll(dir string) error {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(dir, fs.opts.DirMode); err != nil {
+		return err
+	}
+	for _, d := range missing {
+		if err := os.Chmod(d, fs.opts.DirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createFile opens fp with flag, creating it with FileMode if it does not
+// exist. Like mkdirAll, the mode is not narrowed by the umask.
+func (fs *FileService) createFile(fp string, flag int) (*os.File, error) {
+	file, err := os.OpenFile(fp, flag|os.O_CREATE, fs.opts.FileMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(fs.opts.FileMode); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
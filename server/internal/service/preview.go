@@ -0,0 +1,154 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// previewDir is the directory inside uploadDir caching generated previews.
+	previewDir = ".previews"
+	// maxPreviewPixels bounds the source images we are willing to decode.
+	maxPreviewPixels = 50 * 1000 * 1000
+)
+
+// Preview is a downscaled PNG rendition of an image file.
+type Preview struct {
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// GetPreview returns a thumbnail of an image file no larger than the
+// configured maximum dimension. Thumbnails are cached by source checksum.
+func (fs *FileService) GetPreview(ctx context.Context, filename string) (*Preview, error) {
+	log := fs.logger(ctx)
+
+	if err := fs.checkReadable(filename); err != nil {
+		return nil, err
+	}
+
+	if err := fs.downloadSem.acquire(ctx, log); err != nil {
+		return nil, err
+	}
+	defer fs.downloadSem.release()
+
+	hash := sha256.New()
+	if err := fs.readFile(filename, func(r io.Reader) error {
+		_, err := io.Copy(hash, r)
+		return err
+	}); err != nil {
+		log.Error("failed to hash file", "error", err, "filename", filename)
+		return nil, err
+	}
+
+	maxDim := fs.opts.PreviewMaxDimension
+	cachePath := filepath.Join(fs.uploadDir, previewDir,
+		fmt.Sprintf("%s-%d.png", hex.EncodeToString(hash.Sum(nil)), maxDim))
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err == nil {
+			return &Preview{Data: data, Width: cfg.Width, Height: cfg.Height}, nil
+		}
+	}
+
+	var cfg image.Config
+	err := fs.readFile(filename, func(r io.Reader) (err error) {
+		cfg, _, err = image.DecodeConfig(r)
+		return err
+	})
+	if errors.Is(err, image.ErrFormat) {
+		return nil, status.Errorf(codes.FailedPrecondition, "file %q is not an image", filename)
+	}
+	if err != nil {
+		log.Error("failed to read image header", "error", err, "filename", filename)
+		return nil, status.Errorf(codes.FailedPrecondition, "file %q is not a valid image", filename)
+	}
+	if cfg.Width*cfg.Height > maxPreviewPixels {
+		return nil, status.Errorf(codes.FailedPrecondition, "image %q is too large to preview", filename)
+	}
+
+	var src image.Image
+	if err := fs.readFile(filename, func(r io.Reader) (err error) {
+		src, _, err = image.Decode(r)
+		return err
+	}); err != nil {
+		log.Error("failed to decode image", "error", err, "filename", filename)
+		return nil, status.Errorf(codes.FailedPrecondition, "file %q is not a valid image", filename)
+	}
+
+	thumb := downscale(src, maxDim)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, err
+	}
+
+	if err := fs.mkdirAll(filepath.Dir(cachePath)); err != nil {
+		log.Error("failed to create preview directory", "error", err)
+	} else if err := os.WriteFile(cachePath, buf.Bytes(), fs.opts.FileMode); err != nil {
+		log.Error("failed to cache preview", "error", err, "filename", filename)
+	}
+
+	bounds := thumb.Bounds()
+	return &Preview{Data: buf.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// downscale shrinks src so that neither side exceeds maxDim, averaging the
+// source pixels covered by each destination pixel. Smaller images are kept
+// at their original size.
+func downscale(src image.Image, maxDim int) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	dw, dh := sw, sh
+	if sw > maxDim || sh > maxDim {
+		if sw >= sh {
+			dw, dh = maxDim, max(1, sh*maxDim/sw)
+		} else {
+			dw, dh = max(1, sw*maxDim/sh), maxDim
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := sb.Min.Y+y*sh/dh, sb.Min.Y+max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := sb.Min.X+x*sw/dw, sb.Min.X+max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
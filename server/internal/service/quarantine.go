@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// quarantineDir is the directory inside uploadDir holding flagged uploads.
+const quarantineDir = ".quarantine"
+
+// Scanner inspects uploaded content before it becomes available.
+type Scanner interface {
+	// Scan returns a non-empty reason when the content must be quarantined.
+	Scan(ctx context.Context, filename string, r io.Reader) (reason string, err error)
+}
+
+type nopScanner struct{}
+
+func (nopScanner) Scan(context.Context, string, io.Reader) (string, error) {
+	return "", nil
+}
+
+// loadQuarantine restores the quarantine list from the quarantine directory.
+func (fs *FileService) loadQuarantine() error {
+	root := filepath.Join(fs.uploadDir, quarantineDir)
+	err := filepath.WalkDir(root, func(fp string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, fp)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			fs.log.Error("failed to get file info", "error", err, "filename", name)
+			return nil
+		}
+
+		fs.quarantine[name] = FileMetadata{
+			Filename:    name,
+			CreatedAt:   info.ModTime(),
+			UpdatedAt:   info.ModTime(),
+			Quarantined: true,
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		fs.log.Error("failed to read quarantine directory", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// scanFile runs the scanner over a freshly written upload at fp, encrypted
+// with nonce unless it is nil, and moves it to the quarantine directory on a
+// positive detection.
+func (fs *FileService) scanFile(ctx context.Context, filename, fp string, file *os.File, nonce []byte) error {
+	log := fs.logger(ctx)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Error("failed to rewind file for scanning", "error", err, "filename", filename)
+		return err
+	}
+
+	content, err := fs.plaintext(file, nonce)
+	if err != nil {
+		return err
+	}
+
+	reason, err := fs.opts.Scanner.Scan(ctx, filename, content)
+	if err != nil {
+		log.Error("failed to scan file", "error", err, "filename", filename)
+		return err
+	}
+	if reason == "" {
+		return nil
+	}
+
+	qpath := filepath.Join(fs.uploadDir, quarantineDir, filename)
+	if err := fs.mkdirAll(filepath.Dir(qpath)); err != nil {
+		log.Error("failed to create quarantine directory", "error", err)
+		return err
+	}
+
+	if err := os.Rename(fp, qpath); err != nil {
+		log.Error("failed to quarantine file", "error", err, "filename", filename)
+		return err
+	}
+
+	now := time.Now()
+	fs.quarantineLock.Lock()
+	fs.quarantine[filename] = FileMetadata{
+		Filename:         filename,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		Quarantined:      true,
+		QuarantineReason: reason,
+	}
+	fs.quarantineLock.Unlock()
+
+	// quarantine records are not in the write-ahead log
+	if err := fs.saveSnapshot(); err != nil {
+		log.Error("failed to save metadata snapshot", "error", err)
+	}
+
+	log.Warn("file quarantined", "filename", filename, "reason", reason)
+	return status.Errorf(codes.FailedPrecondition, "file %q was quarantined: %s", filename, reason)
+}
+
+// ListQuarantine returns the files held in quarantine.
+func (fs *FileService) ListQuarantine(ctx context.Context) ([]FileMetadata, error) {
+	if err := fs.listSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return nil, err
+	}
+	defer fs.listSem.release()
+
+	fs.quarantineLock.RLock()
+	defer fs.quarantineLock.RUnlock()
+
+	files := make([]FileMetadata, 0, len(fs.quarantine))
+	for _, meta := range fs.quarantine {
+		files = append(files, meta)
+	}
+
+	return files, nil
+}
+
+// checkQuarantine fails with FailedPrecondition, giving the reason, if
+// filename is only held in quarantine. A file uploaded again under the same
+// name after being quarantined is served as usual.
+func (fs *FileService) checkQuarantine(filename string) error {
+	if _, ok := fs.lookup(filename); ok {
+		return nil
+	}
+
+	fs.quarantineLock.RLock()
+	meta, ok := fs.quarantine[filename]
+	fs.quarantineLock.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if meta.QuarantineReason == "" {
+		return status.Errorf(codes.FailedPrecondition, "file %q is quarantined", filename)
+	}
+	return status.Errorf(codes.FailedPrecondition, "file %q is quarantined: %s", filename, meta.QuarantineReason)
+}
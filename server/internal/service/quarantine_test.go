@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rejectScanner quarantines every upload.
+type rejectScanner struct{}
+
+func (rejectScanner) Scan(context.Context, string, io.Reader) (string, error) {
+	return "test signature", nil
+}
+
+func TestReadQuarantined(t *testing.T) {
+	fs := newTestService(t, Options{Scanner: rejectScanner{}, CaseInsensitiveNames: true})
+
+	ctx := context.Background()
+	_, _, err := fs.UploadFile(ctx, UploadInfo{Filename: "Report.pdf"}, bytes.NewReader([]byte("content")))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("upload: got %v, want FailedPrecondition", err)
+	}
+
+	for _, filename := range []string{"Report.pdf", "report.pdf"} {
+		if _, err := download(fs, filename); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("download(%q): got %v, want FailedPrecondition", filename, err)
+		}
+		if d, err := fs.DownloadRange(ctx, filename, 1, 2); status.Code(err) != codes.FailedPrecondition {
+			t.Errorf("DownloadRange(%q): got %v, want FailedPrecondition", filename, err)
+			if err == nil {
+				d.Close()
+			}
+		}
+	}
+}
+
+func TestReadInternalFiles(t *testing.T) {
+	fs := newTestService(t, Options{Scanner: rejectScanner{}})
+
+	ctx := context.Background()
+	fs.UploadFile(ctx, UploadInfo{Filename: "report.pdf"}, bytes.NewReader([]byte("content")))
+
+	for _, filename := range []string{metadataFile, quarantineDir + "/report.pdf"} {
+		if _, err := download(fs, filename); status.Code(err) != codes.NotFound {
+			t.Errorf("download(%q): got %v, want NotFound", filename, err)
+		}
+		if d, err := fs.DownloadRange(ctx, filename, 1, 2); status.Code(err) != codes.NotFound {
+			t.Errorf("DownloadRange(%q): got %v, want NotFound", filename, err)
+			if err == nil {
+				d.Close()
+			}
+		}
+		if _, err := fs.GetFileInfo(ctx, filename); status.Code(err) != codes.NotFound {
+			t.Errorf("GetFileInfo(%q): got %v, want NotFound", filename, err)
+		}
+		if _, err := fs.GetHexdump(ctx, filename, 0); status.Code(err) != codes.NotFound {
+			t.Errorf("GetHexdump(%q): got %v, want NotFound", filename, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RenameFile moves a stored file to a new name, which may be in another
+// subdirectory. The file keeps its creation time and content, its
+// generation is bumped like on any other write. Renaming onto an existing
+// file is refused; with case-insensitive names a file can still be renamed
+// to a case variant of its own name. A set ifGenerationMatch only renames
+// the file if it is still at that generation.
+func (fs *FileService) RenameFile(ctx context.Context, from, to string, ifGenerationMatch *int64) (FileMetadata, error) {
+	for _, filename := range []string{from, to} {
+		if err := sanitizeFilename(filename); err != nil {
+			return FileMetadata{}, err
+		}
+		if isInternalFile(filename) {
+			return FileMetadata{}, status.Errorf(codes.InvalidArgument, "filename %q is reserved", filename)
+		}
+	}
+	// a rename must not get around the upload restriction
+	if err := fs.checkExtension(to); err != nil {
+		return FileMetadata{}, err
+	}
+
+	if err := fs.uploadSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return FileMetadata{}, err
+	}
+	defer fs.uploadSem.release()
+
+	meta, err := fs.rename(from, to, ifGenerationMatch)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+
+	fs.persistMetadata()
+
+	fs.logger(ctx).Info("file renamed", "from", from, "to", to)
+	return meta, nil
+}
+
+// rename moves the file on disk and in the index under the locks of both
+// names.
+func (fs *FileService) rename(from, to string, ifGenerationMatch *int64) (FileMetadata, error) {
+	fromKey, toKey := fs.metadataKey(from), fs.metadataKey(to)
+	unlock := fs.metadata.lock(fromKey, toKey)
+	defer unlock()
+
+	meta, ok := fs.metadata.get(fromKey)
+	if !ok {
+		return FileMetadata{}, status.Errorf(codes.NotFound, "file %q not found", from)
+	}
+	if err := fs.checkGeneration(from, ifGenerationMatch); err != nil {
+		return FileMetadata{}, err
+	}
+	if meta.Filename == to {
+		return meta, nil
+	}
+	if existing, ok := fs.metadata.get(toKey); ok && toKey != fromKey {
+		return FileMetadata{}, status.Errorf(codes.AlreadyExists, "file %q already exists", existing.Filename)
+	}
+
+	dst, err := fs.prepareDestination(to)
+	if err != nil {
+		return FileMetadata{}, err
+	}
+	if toKey != fromKey {
+		// a file the index does not know of, e.g. one copied into the upload
+		// directory since startup, must not be replaced either
+		if _, err := os.Lstat(dst); err == nil {
+			return FileMetadata{}, status.Errorf(codes.AlreadyExists, "file %q already exists", to)
+		}
+	}
+
+	if err := os.Rename(filepath.Join(fs.uploadDir, meta.Filename), dst); err != nil {
+		fs.log.Error("failed to rename file", "error", err, "from", meta.Filename, "to", to)
+		return FileMetadata{}, err
+	}
+
+	fs.metadata.delete(fromKey)
+	meta.Filename = to
+	meta.UpdatedAt = time.Now()
+	meta.Generation++
+	fs.metadata.put(toKey, meta)
+
+	return meta, nil
+}
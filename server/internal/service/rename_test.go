@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRenameGenerationMatch(t *testing.T) {
+	ctx := context.Background()
+	gen := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name string
+		want *int64
+		code codes.Code
+	}{
+		{"no precondition", nil, codes.OK},
+		{"match", gen(2), codes.OK},
+		{"mismatch", gen(1), codes.FailedPrecondition},
+		{"must not exist", gen(0), codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		fs := newTestService(t, Options{})
+		upload(t, fs, "a.txt", []byte("first"))
+		if _, _, err := fs.UploadFile(ctx, UploadInfo{Filename: "a.txt", Overwrite: true}, strings.NewReader("second")); err != nil {
+			t.Fatalf("overwrite: %v", err)
+		}
+
+		meta, err := fs.RenameFile(ctx, "a.txt", "b.txt", tt.want)
+		if status.Code(err) != tt.code {
+			t.Errorf("%s: RenameFile = %v, want %v", tt.name, err, tt.code)
+			continue
+		}
+		if err != nil {
+			if _, ok := fs.lookup("a.txt"); !ok {
+				t.Errorf("%s: failed rename moved the file", tt.name)
+			}
+			continue
+		}
+		if meta.Filename != "b.txt" || meta.Generation != 3 {
+			t.Errorf("%s: renamed to %q at generation %d, want b.txt at 3", tt.name, meta.Filename, meta.Generation)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// partialDir is the directory inside uploadDir holding the bytes received so
+// far of interrupted resumable uploads.
+const partialDir = ".partial"
+
+func (fs *FileService) partialPath(filename string) string {
+	return filepath.Join(fs.uploadDir, partialDir, filename)
+}
+
+// UploadOffset returns the number of bytes stored for an interrupted
+// resumable upload of filename, which is where the upload resumes. It is 0
+// if there is none.
+func (fs *FileService) UploadOffset(ctx context.Context, filename string) (int64, error) {
+	if err := sanitizeFilename(filename); err != nil {
+		return 0, err
+	}
+	if isInternalFile(filename) {
+		return 0, status.Errorf(codes.InvalidArgument, "filename %q is reserved", filename)
+	}
+
+	info, err := os.Stat(fs.partialPath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		fs.logger(ctx).Error("failed to stat partial upload", "error", err, "filename", filename)
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// receivePartial appends data to the partial upload of info.Filename, which
+// must currently hold exactly info.Offset bytes. If data ends early the bytes
+// received are kept for the next attempt. On success the whole partial file
+// is returned, rewound, for the caller to process and pass to finishPartial.
+func (fs *FileService) receivePartial(info UploadInfo, data io.Reader) (*os.File, error) {
+	filename := info.Filename
+
+	if fs.masterKey != nil {
+		// partial uploads would sit on disk unencrypted
+		return nil, status.Error(codes.FailedPrecondition,
+			"resumable uploads are not available with encryption at rest")
+	}
+
+	fs.partialLock.Lock()
+	if fs.resuming[filename] {
+		fs.partialLock.Unlock()
+		return nil, status.Errorf(codes.Aborted, "upload of %q is already in progress", filename)
+	}
+	fs.resuming[filename] = true
+	fs.partialLock.Unlock()
+
+	file, err := fs.appendPartial(info, data)
+	if err != nil {
+		fs.partialLock.Lock()
+		delete(fs.resuming, filename)
+		fs.partialLock.Unlock()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (fs *FileService) appendPartial(info UploadInfo, data io.Reader) (*os.File, error) {
+	filename := info.Filename
+	fp := fs.partialPath(filename)
+
+	if err := fs.mkdirAll(filepath.Dir(fp)); err != nil {
+		fs.log.Error("failed to create partial upload directory", "error", err)
+		return nil, err
+	}
+
+	file, err := fs.createFile(fp, os.O_RDWR|os.O_APPEND)
+	if err != nil {
+		fs.log.Error("failed to open partial upload", "error", err, "filename", filename)
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		fs.log.Error("failed to stat partial upload", "error", err, "filename", filename)
+		return nil, err
+	}
+	if stat.Size() != info.Offset {
+		file.Close()
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"upload of %q is at offset %d, not %d", filename, stat.Size(), info.Offset)
+	}
+
+	if fs.opts.MaxFileSize > 0 {
+		data = io.LimitReader(data, fs.opts.MaxFileSize-info.Offset+1)
+	}
+
+	n, err := io.Copy(file, data)
+	if err != nil {
+		file.Close()
+		fs.log.Warn("upload interrupted, keeping partial file",
+			"filename", filename, "offset", info.Offset+n, "error", err)
+		return nil, err
+	}
+
+	if fs.opts.MaxFileSize > 0 && info.Offset+n > fs.opts.MaxFileSize {
+		file.Close()
+		os.Remove(fp)
+		fs.log.Warn("file too large", "filename", filename, "limit", fs.opts.MaxFileSize)
+		return nil, status.Errorf(codes.ResourceExhausted,
+			"file %q exceeds the maximum size of %d bytes", filename, fs.opts.MaxFileSize)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		fs.log.Error("failed to rewind partial upload", "error", err, "filename", filename)
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// finishPartial removes a partial upload once it has been processed, whether
+// it was published or rejected.
+func (fs *FileService) finishPartial(filename string, file *os.File) {
+	file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		fs.log.Error("failed to remove partial upload", "error", err, "filename", filename)
+	}
+
+	fs.partialLock.Lock()
+	delete(fs.resuming, filename)
+	fs.partialLock.Unlock()
+}
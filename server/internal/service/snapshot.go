@@ -0,0 +1,203 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// metadataFile is the metadata snapshot kept inside uploadDir.
+const metadataFile = ".metadata.json"
+
+type metadataSnapshot struct {
+	Files      []FileMetadata `json:"files"`
+	Quarantine []FileMetadata `json:"quarantine"`
+}
+
+// isInternalFile reports whether name is bookkeeping kept by the service
+// itself rather than an uploaded file, or lies in one of its directories.
+func isInternalFile(name string) bool {
+	top, _, _ := strings.Cut(name, "/")
+	switch top {
+	case metadataFile, metadataFile + ".tmp", walFile, walFile + ".old", stagingDir, partialDir, quarantineDir, previewDir:
+		return true
+	}
+	return false
+}
+
+// loadSnapshot overlays the saved metadata, with the write-ahead log
+// replayed on top, on what was found on disk. Records for files that no
+// longer exist are dropped.
+func (fs *FileService) loadSnapshot() error {
+	var snap metadataSnapshot
+	data, err := os.ReadFile(filepath.Join(fs.uploadDir, metadataFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		fs.log.Error("failed to read metadata snapshot", "error", err)
+		return err
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			fs.log.Error("failed to parse metadata snapshot, ignoring it", "error", err)
+			snap = metadataSnapshot{}
+		}
+	}
+
+	files := make(map[string]FileMetadata, len(snap.Files))
+	for _, meta := range snap.Files {
+		files[meta.Filename] = meta
+	}
+	// replayed even with the log disabled, so turning it off loses nothing
+	if err := fs.replayWAL(files); err != nil {
+		return err
+	}
+
+	for _, meta := range files {
+		key := fs.metadataKey(meta.Filename)
+		if existing, ok := fs.metadata.get(key); ok && existing.Filename == meta.Filename {
+			// snapshots from before generations were tracked
+			meta.Generation = max(meta.Generation, 1)
+			// the file on disk is authoritative for its size, and the
+			// record for whether it is encrypted
+			meta.PhysicalSizeBytes = existing.PhysicalSizeBytes
+			meta.SizeBytes = meta.PhysicalSizeBytes
+			if meta.Encrypted {
+				meta.SizeBytes = encryptedPlaintextSize(meta.PhysicalSizeBytes)
+			}
+			fs.metadata.put(key, meta)
+		}
+	}
+	for _, meta := range snap.Quarantine {
+		if _, ok := fs.quarantine[meta.Filename]; ok {
+			fs.quarantine[meta.Filename] = meta
+		}
+	}
+
+	return nil
+}
+
+// saveSnapshot writes the metadata to a temp file and renames it into place,
+// so a crash never leaves a half-written snapshot behind. With the
+// write-ahead log enabled this compacts it: the changes logged so far are
+// all in the snapshot and their log is removed once it is written.
+func (fs *FileService) saveSnapshot() error {
+	fs.snapshotLock.Lock()
+	defer fs.snapshotLock.Unlock()
+
+	if fs.wal != nil {
+		if err := fs.wal.rotate(); err != nil {
+			fs.log.Error("failed to rotate write-ahead log", "error", err)
+			return err
+		}
+	}
+
+	if err := fs.writeSnapshot(); err != nil {
+		return err
+	}
+
+	if fs.wal != nil {
+		return fs.wal.compacted()
+	}
+	return nil
+}
+
+func (fs *FileService) writeSnapshot() error {
+	snap := metadataSnapshot{Files: fs.metadata.all()}
+
+	fs.quarantineLock.RLock()
+	snap.Quarantine = make([]FileMetadata, 0, len(fs.quarantine))
+	for _, meta := range fs.quarantine {
+		snap.Quarantine = append(snap.Quarantine, meta)
+	}
+	fs.quarantineLock.RUnlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	fp := filepath.Join(fs.uploadDir, metadataFile)
+	tmp := fp + ".tmp"
+
+	file, err := fs.createFile(tmp, os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, fp)
+}
+
+// persistMetadata saves the metadata after a change: it flushes the
+// write-ahead log if enabled and writes a snapshot otherwise. A failure is
+// only logged: the change itself already happened, and the next snapshot
+// retries.
+func (fs *FileService) persistMetadata() {
+	if fs.wal != nil {
+		if err := fs.wal.sync(); err != nil {
+			fs.log.Error("failed to write write-ahead log", "error", err)
+		}
+		return
+	}
+
+	if err := fs.saveSnapshot(); err != nil {
+		fs.log.Error("failed to save metadata snapshot", "error", err)
+	}
+}
+
+// runSnapshots saves the metadata every interval until Close is called.
+func (fs *FileService) runSnapshots(interval time.Duration) {
+	defer close(fs.snapshotDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := fs.saveSnapshot(); err != nil {
+				fs.log.Error("failed to save metadata snapshot", "error", err)
+			}
+		case <-fs.snapshotStop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic snapshots and flushes the metadata one last time.
+func (fs *FileService) Close() error {
+	if fs.snapshotStop != nil {
+		close(fs.snapshotStop)
+		<-fs.snapshotDone
+	}
+
+	if err := fs.saveSnapshot(); err != nil {
+		fs.log.Error("failed to save metadata snapshot", "error", err)
+		return err
+	}
+
+	if fs.wal != nil {
+		if err := fs.wal.close(); err != nil {
+			fs.log.Error("failed to close write-ahead log", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxStatBatch caps the number of files a single StatFiles call reports on.
+const maxStatBatch = 1000
+
+// StatResult is the metadata of one file asked for in StatFiles, or the
+// reason it could not be looked up.
+type StatResult struct {
+	Filename string
+	Metadata FileMetadata
+	Err      error
+}
+
+// GetFileInfo returns the metadata of a single file.
+func (fs *FileService) GetFileInfo(ctx context.Context, filename string) (FileMetadata, error) {
+	if err := fs.checkReadable(filename); err != nil {
+		return FileMetadata{}, err
+	}
+
+	meta, ok := fs.lookup(filename)
+	if !ok {
+		if err := fs.checkQuarantine(fs.resolveName(filename)); err != nil {
+			return FileMetadata{}, err
+		}
+		return FileMetadata{}, status.Errorf(codes.NotFound, "file %q not found", filename)
+	}
+	return meta, nil
+}
+
+// StatFiles looks up the metadata of every named file, plus every listed file
+// matching pattern if it is set. Named files come first in the order given,
+// followed by the matches sorted by name. A missing or invalid name fails
+// only its own entry.
+func (fs *FileService) StatFiles(ctx context.Context, filenames []string, pattern string) ([]StatResult, error) {
+	if len(filenames) > maxStatBatch {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"batch of %d files exceeds the limit of %d", len(filenames), maxStatBatch)
+	}
+	if err := checkPattern(pattern); err != nil {
+		return nil, err
+	}
+
+	release, err := fs.acquireList(ctx, pattern != "")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	results := make([]StatResult, 0, len(filenames))
+	for _, filename := range filenames {
+		result := StatResult{Filename: filename}
+		if err := fs.checkReadable(filename); err != nil {
+			result.Err = err
+		} else if meta, ok := fs.lookup(filename); ok {
+			result.Metadata = meta
+		} else if err := fs.checkQuarantine(fs.resolveName(filename)); err != nil {
+			result.Err = err
+		} else {
+			result.Err = status.Errorf(codes.NotFound, "file %q not found", filename)
+		}
+		results = append(results, result)
+	}
+
+	if pattern == "" {
+		return results, nil
+	}
+
+	var matches []StatResult
+	for _, meta := range fs.metadata.all() {
+		if fs.isHidden(meta.Filename) {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, meta.Filename); !ok {
+			continue
+		}
+		if len(results)+len(matches) >= maxStatBatch {
+			return nil, status.Errorf(codes.InvalidArgument,
+				"pattern %q matches more than %d files", pattern, maxStatBatch)
+		}
+		matches = append(matches, StatResult{Filename: meta.Filename, Metadata: meta})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Filename < matches[j].Filename
+	})
+
+	return append(results, matches...), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package service
+
+// freeInodes is not supported on this platform.
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
+
+// freeBytes is not supported on this platform.
+func freeBytes(path string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
@@ -0,0 +1,32 @@
+//go:build linux || darwin
+
+package service
+
+import "syscall"
+
+// freeInodes reports the number of free inodes on the filesystem holding path.
+// ok is false when the filesystem does not track inodes.
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+
+	// filesystems without a fixed inode table (e.g. btrfs) report zero
+	if st.Files == 0 {
+		return 0, false, nil
+	}
+
+	return uint64(st.Ffree), true, nil
+}
+
+// freeBytes reports the number of bytes available to unprivileged users on
+// the filesystem holding path.
+func freeBytes(path string) (free uint64, ok bool, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), true, nil
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StoreStats summarizes the stored files.
+type StoreStats struct {
+	Files int
+	Bytes int64
+	// ByExtension groups the files by lowercased extension, "" for files
+	// without one, sorted by extension.
+	ByExtension []ExtensionStats
+	// Largest and Oldest are unset when the store is empty.
+	Largest FileMetadata
+	Oldest  FileMetadata
+}
+
+// ExtensionStats counts the files sharing an extension.
+type ExtensionStats struct {
+	Extension string
+	Files     int
+	Bytes     int64
+}
+
+// Usage is a summary of the store and the operations running on it that is
+// cheap enough to poll, unlike Stats.
+type Usage struct {
+	InFlight
+	Files int
+	Bytes int64
+}
+
+// Usage reports the running operations and the number and total size of
+// the stored files, hidden ones included.
+func (fs *FileService) Usage() Usage {
+	return Usage{
+		InFlight: fs.InFlight(),
+		Files:    fs.metadata.len(),
+		Bytes:    fs.metadata.size(),
+	}
+}
+
+// Stats aggregates the metadata of every stored file, hidden ones included,
+// without listing them.
+func (fs *FileService) Stats(ctx context.Context) (StoreStats, error) {
+	if err := fs.listSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return StoreStats{}, err
+	}
+	defer fs.listSem.release()
+
+	var stats StoreStats
+	byExt := make(map[string]*ExtensionStats)
+	for _, meta := range fs.metadata.all() {
+		stats.Files++
+		stats.Bytes += meta.SizeBytes
+
+		ext := strings.ToLower(filepath.Ext(meta.Filename))
+		es, ok := byExt[ext]
+		if !ok {
+			es = &ExtensionStats{Extension: ext}
+			byExt[ext] = es
+		}
+		es.Files++
+		es.Bytes += meta.SizeBytes
+
+		if stats.Files == 1 || meta.SizeBytes > stats.Largest.SizeBytes {
+			stats.Largest = meta
+		}
+		if stats.Files == 1 || meta.CreatedAt.Before(stats.Oldest.CreatedAt) {
+			stats.Oldest = meta
+		}
+	}
+
+	stats.ByExtension = make([]ExtensionStats, 0, len(byExt))
+	for _, es := range byExt {
+		stats.ByExtension = append(stats.ByExtension, *es)
+	}
+	sort.Slice(stats.ByExtension, func(i, j int) bool {
+		return stats.ByExtension[i].Extension < stats.ByExtension[j].Extension
+	})
+
+	return stats, nil
+}
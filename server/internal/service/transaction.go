@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// stagingDir is the directory inside uploadDir holding uncommitted
+// transactions. Staging lives on the same volume so commits are renames.
+const stagingDir = ".staging"
+
+// Transaction stages a set of uploads and publishes them all at once on
+// Commit, or none of them on Abort.
+type Transaction struct {
+	fs     *FileService
+	dir    string
+	staged []FileMetadata
+	// conditions holds the upload info of each staged file, checked again
+	// on commit
+	conditions []UploadInfo
+	names      map[string]bool
+	once       sync.Once
+}
+
+// BeginTransaction starts a transaction. It holds one upload slot until it is
+// committed or aborted.
+func (fs *FileService) BeginTransaction(ctx context.Context) (*Transaction, error) {
+	if err := fs.uploadSem.acquire(ctx, fs.logger(ctx)); err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(fs.uploadDir, stagingDir)
+	if err := fs.mkdirAll(root); err != nil {
+		fs.uploadSem.release()
+		fs.logger(ctx).Error("failed to create staging directory", "error", err)
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(root, "tx-")
+	if err != nil {
+		fs.uploadSem.release()
+		fs.logger(ctx).Error("failed to create transaction directory", "error", err)
+		return nil, err
+	}
+
+	return &Transaction{
+		fs:    fs,
+		dir:   dir,
+		names: make(map[string]bool),
+	}, nil
+}
+
+// Stage uploads one file into the transaction's staging area.
+func (t *Transaction) Stage(ctx context.Context, info UploadInfo, data io.Reader) error {
+	fs := t.fs
+	filename := info.Filename
+
+	if err := sanitizeFilename(filename); err != nil {
+		return err
+	}
+	if isInternalFile(filename) {
+		return status.Errorf(codes.InvalidArgument, "filename %q is reserved", filename)
+	}
+	if err := fs.checkExtension(filename); err != nil {
+		return err
+	}
+	if info.Resumable {
+		return status.Error(codes.InvalidArgument, "resumable uploads cannot be part of a transaction")
+	}
+
+	key := fs.metadataKey(filename)
+	if t.names[key] {
+		return status.Errorf(codes.InvalidArgument, "file %q is already part of the transaction", filename)
+	}
+
+	if err := fs.checkFreeInodes(); err != nil {
+		return err
+	}
+
+	if err := fs.checkFreeSpace(info); err != nil {
+		return err
+	}
+
+	if err := fs.checkCaseCollision(filename); err != nil {
+		return err
+	}
+
+	if err := fs.checkNotDirectory(filename); err != nil {
+		return err
+	}
+
+	unlock := fs.metadata.rlock(key)
+	err := fs.checkPrecondition(info)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	fp := filepath.Join(t.dir, strconv.Itoa(len(t.staged)))
+	meta, err := fs.writeFile(ctx, info, fp, data)
+	if err != nil {
+		os.Remove(fp)
+		return err
+	}
+
+	t.names[key] = true
+	t.staged = append(t.staged, meta)
+	t.conditions = append(t.conditions, info)
+	return nil
+}
+
+// Commit publishes every staged file. If any file cannot be moved into place
+// the files published so far are rolled back and the previous versions
+// restored. Nothing is published if a file's precondition no longer holds.
+func (t *Transaction) Commit() error {
+	fs := t.fs
+	defer t.finish()
+
+	backupDir := filepath.Join(t.dir, "backup")
+	if err := os.Mkdir(backupDir, fs.opts.DirMode); err != nil {
+		fs.log.Error("failed to create backup directory", "error", err)
+		return err
+	}
+
+	// runs after the locks below are released; after a rollback it just
+	// rewrites the unchanged metadata
+	defer fs.persistMetadata()
+
+	keys := make([]string, len(t.staged))
+	for i, meta := range t.staged {
+		keys[i] = fs.metadataKey(meta.Filename)
+	}
+	defer fs.metadata.lock(keys...)()
+
+	type published struct {
+		dst    string
+		backup string
+	}
+	var done []published
+
+	rollback := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Remove(done[i].dst); err != nil {
+				fs.log.Error("failed to roll back file", "error", err, "path", done[i].dst)
+			}
+			if done[i].backup == "" {
+				continue
+			}
+			if err := os.Rename(done[i].backup, done[i].dst); err != nil {
+				fs.log.Error("failed to restore file", "error", err, "path", done[i].dst)
+			}
+		}
+	}
+
+	for _, info := range t.conditions {
+		if err := fs.checkPrecondition(info); err != nil {
+			return err
+		}
+	}
+
+	for i, meta := range t.staged {
+		dst, err := fs.prepareDestination(meta.Filename)
+		if err != nil {
+			rollback()
+			return err
+		}
+		p := published{dst: dst}
+
+		if _, err := os.Stat(p.dst); err == nil {
+			p.backup = filepath.Join(backupDir, strconv.Itoa(i))
+			if err := os.Rename(p.dst, p.backup); err != nil {
+				fs.log.Error("failed to back up file", "error", err, "filename", meta.Filename)
+				rollback()
+				return status.Errorf(codes.Aborted, "failed to commit %q", meta.Filename)
+			}
+		}
+
+		if err := os.Rename(filepath.Join(t.dir, strconv.Itoa(i)), p.dst); err != nil {
+			fs.log.Error("failed to publish file", "error", err, "filename", meta.Filename)
+			if p.backup != "" {
+				os.Rename(p.backup, p.dst)
+			}
+			rollback()
+			return status.Errorf(codes.Aborted, "failed to commit %q", meta.Filename)
+		}
+
+		done = append(done, p)
+	}
+
+	now := time.Now()
+	for _, meta := range t.staged {
+		meta.CreatedAt = now
+		meta.UpdatedAt = now
+		fs.publish(&meta)
+	}
+
+	return nil
+}
+
+// Abort discards every staged file. It is a no-op after Commit.
+func (t *Transaction) Abort() {
+	t.finish()
+}
+
+// Filenames returns the names staged so far.
+func (t *Transaction) Filenames() []string {
+	names := make([]string, 0, len(t.staged))
+	for _, meta := range t.staged {
+		names = append(names, meta.Filename)
+	}
+	return names
+}
+
+func (t *Transaction) finish() {
+	t.once.Do(func() {
+		if err := os.RemoveAll(t.dir); err != nil {
+			t.fs.log.Error("failed to remove transaction directory", "error", err)
+		}
+		t.fs.uploadSem.release()
+	})
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walFile is the write-ahead log of metadata changes kept inside uploadDir
+// when Options.MetadataWAL is set. While a snapshot is being written the log
+// is moved aside to walFile + ".old" and a fresh one started.
+const walFile = ".metadata.wal"
+
+const (
+	walPut    = "put"
+	walDelete = "delete"
+)
+
+// walEntry is one line of the write-ahead log.
+type walEntry struct {
+	Op   string       `json:"op"`
+	File FileMetadata `json:"file"`
+}
+
+// metadataWAL appends metadata changes to the write-ahead log. Changes are
+// recorded by the metadata index as they happen and buffered until sync
+// writes and fsyncs them, so concurrent changes share one fsync. A nil
+// *metadataWAL records nothing.
+type metadataWAL struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending []byte
+	mode    os.FileMode
+	log     *slog.Logger
+}
+
+func openWAL(path string, mode os.FileMode, log *slog.Logger) (*metadataWAL, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &metadataWAL{path: path, file: file, mode: mode, log: log}, nil
+}
+
+// record buffers a change until the next sync.
+func (w *metadataWAL) record(op string, meta FileMetadata) {
+	if w == nil {
+		return
+	}
+
+	line, err := json.Marshal(walEntry{Op: op, File: meta})
+	if err != nil {
+		w.log.Error("failed to encode write-ahead log entry", "error", err, "filename", meta.Filename)
+		return
+	}
+
+	w.mu.Lock()
+	w.pending = append(append(w.pending, line...), '\n')
+	w.mu.Unlock()
+}
+
+// sync writes the buffered changes to the log and flushes it to disk.
+func (w *metadataWAL) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *metadataWAL) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	info, err := w.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(w.pending); err != nil {
+		// cut off a partial write, which would end the log on replay
+		w.file.Truncate(info.Size())
+		return err
+	}
+	w.pending = w.pending[:0]
+	return w.file.Sync()
+}
+
+// rotate moves the log aside so a snapshot can be taken, and starts a fresh
+// one for the changes made meanwhile. If an earlier snapshot failed and left
+// the old log behind, the current log is appended to it instead, as the old
+// entries are not in any snapshot yet.
+func (w *metadataWAL) rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	old := w.path + ".old"
+	if _, err := os.Stat(old); err == nil {
+		if err := appendFile(old, w.path); err != nil {
+			return err
+		}
+		return w.file.Truncate(0)
+	}
+
+	if err := os.Rename(w.path, old); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, w.mode)
+	if err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file = file
+	return nil
+}
+
+// compacted removes the log moved aside by rotate once the snapshot holding
+// its changes is on disk.
+func (w *metadataWAL) compacted() error {
+	err := os.Remove(w.path + ".old")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (w *metadataWAL) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// dropWAL folds a log left behind from when the log was enabled, and
+// already replayed, into a snapshot and removes it, so it is not replayed
+// over changes made without it.
+func (fs *FileService) dropWAL() error {
+	path := filepath.Join(fs.uploadDir, walFile)
+	found := false
+	for _, fp := range []string{path + ".old", path} {
+		if _, err := os.Stat(fp); err == nil {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	if err := fs.saveSnapshot(); err != nil {
+		return err
+	}
+	for _, fp := range []string{path + ".old", path} {
+		if err := os.Remove(fp); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFile appends the content of src to dst and flushes dst to disk.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// replayWAL applies the logged changes, the moved aside log first, to files,
+// which holds the snapshot's records by filename. A log ends at its first
+// incomplete or unreadable entry, which is what a crash in the middle of a
+// write leaves behind; everything before it is applied.
+func (fs *FileService) replayWAL(files map[string]FileMetadata) error {
+	path := filepath.Join(fs.uploadDir, walFile)
+	for _, fp := range []string{path + ".old", path} {
+		n, err := fs.replayWALFile(fp, files)
+		if err != nil {
+			fs.log.Error("failed to read write-ahead log", "error", err, "path", fp)
+			return err
+		}
+		if n > 0 {
+			fs.log.Info("replayed write-ahead log", "path", fp, "entries", n)
+		}
+	}
+	return nil
+}
+
+func (fs *FileService) replayWALFile(fp string, files map[string]FileMetadata) (int, error) {
+	file, err := os.Open(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	n := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				fs.log.Warn("ignoring incomplete write-ahead log entry", "path", fp, "entry", n+1)
+			}
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		var entry walEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			fs.log.Warn("ignoring the rest of the write-ahead log after an unreadable entry",
+				"error", err, "path", fp, "entry", n+1)
+			return n, nil
+		}
+
+		switch entry.Op {
+		case walPut:
+			files[entry.File.Filename] = entry.File
+		case walDelete:
+			delete(files, entry.File.Filename)
+		default:
+			fs.log.Warn("ignoring the rest of the write-ahead log after an unknown operation",
+				"op", entry.Op, "path", fp, "entry", n+1)
+			return n, nil
+		}
+		n++
+	}
+}